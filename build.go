@@ -0,0 +1,793 @@
+// This file is part of DD Jack Compiler.
+// Copyright (C) 2025-2025 Eduardo <dudssource@gmail.com>
+//
+// Jack Compiler is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Jack Compiler is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Jack Compiler.  If not, see <http://www.gnu.org/licenses/>.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/Dudssource/dd-jack-compiler/compiler"
+	"github.com/Dudssource/dd-jack-compiler/compiler/diag"
+)
+
+// build compiles the files to VM code, or to any of the output modes
+func build(cmd *command, args []string) int {
+
+	var (
+		opts    options
+		flags   = cmd.flagSet()
+		modes   = make([]string, 0, len(compiler.OutputModes))
+		mode    string
+		xmlMode bool
+	)
+	for _, m := range compiler.OutputModes {
+		modes = append(modes, string(m))
+	}
+
+	flags.StringVar(&opts.outDir, "o", "", "output directory mirroring the tree of the sources, - writes to stdout (default next to the sources)")
+	flags.StringVar(&mode, "mode", string(compiler.VMOutput), "output: "+strings.Join(modes, ", "))
+	flags.BoolVar(&xmlMode, "xml", false, "same as -mode xml")
+	opts.discoveryFlags(flags)
+	opts.compilerFlags(flags)
+	flags.BoolVar(&opts.dropUnreachable, "drop-unreachable", false, "leave the unreachable statements out of the VM code")
+	flags.BoolVar(&opts.debug, "debug", false, "print the symbol tables while compiling")
+
+	programs, code, ok := opts.parseArgs(flags, args, func() error {
+		if xmlMode {
+			mode = string(compiler.XMLOutput)
+		}
+		opts.mode = compiler.OutputMode(mode)
+		if !slices.Contains(compiler.OutputModes, opts.mode) {
+			return fmt.Errorf("unknown mode %s", mode)
+		}
+		return nil
+	})
+	if !ok {
+		return code
+	}
+
+	return newCompilation(opts).buildAll(programs)
+}
+
+// check compiles the files only for their diagnostics
+func check(cmd *command, args []string) int {
+	opts := options{mode: compiler.VMOutput, discard: true}
+	flags := cmd.flagSet()
+	opts.discoveryFlags(flags)
+	opts.compilerFlags(flags)
+
+	programs, code, ok := opts.parseArgs(flags, args, nil)
+	if !ok {
+		return code
+	}
+
+	c := newCompilation(opts)
+	if code := c.buildAll(programs); code != exitOK {
+		return code
+	}
+	c.logger.Printf("no errors found in %d file(s)", c.files)
+	return exitOK
+}
+
+// tokens writes the tokenizer XML of the files
+func tokens(cmd *command, args []string) int {
+	opts := options{mode: compiler.TokensOutput}
+	flags := cmd.flagSet()
+	flags.StringVar(&opts.outDir, "o", "", "output directory mirroring the tree of the sources, - writes to stdout (default next to the sources)")
+	opts.discoveryFlags(flags)
+
+	programs, code, ok := opts.parseArgs(flags, args, nil)
+	if !ok {
+		return code
+	}
+	return newCompilation(opts).buildAll(programs)
+}
+
+// parse writes the parse tree of the files
+func parse(cmd *command, args []string) int {
+	var (
+		opts   options
+		flags  = cmd.flagSet()
+		format string
+	)
+	flags.StringVar(&opts.outDir, "o", "", "output directory mirroring the tree of the sources, - writes to stdout (default next to the sources)")
+	flags.StringVar(&format, "format", string(compiler.XMLOutput), "tree format: xml (project 10) or ast (syntax tree)")
+	opts.discoveryFlags(flags)
+
+	programs, code, ok := opts.parseArgs(flags, args, func() error {
+		opts.mode = compiler.OutputMode(format)
+		if opts.mode != compiler.XMLOutput && opts.mode != compiler.ASTOutput {
+			return fmt.Errorf("unknown format %s", format)
+		}
+		return nil
+	})
+	if !ok {
+		return code
+	}
+	return newCompilation(opts).buildAll(programs)
+}
+
+// program jack files compiled together
+type program struct {
+	dir       string
+	srcPaths  []string // files to compile
+	declPaths []string // other files of the folder, only their declarations are needed
+	whole     bool     // every file of the folder is compiled
+	outDir    string   // folder of the outputs, relative to the output directory
+}
+
+// discover groups the paths by folder, a folder is a program of its own while the files given
+// on their own are compiled with the declarations of the other files of their folder. With recursive
+// every folder with jack files below the folders given is a program as well
+func discover(paths []string, recursive bool) ([]*program, error) {
+
+	var (
+		programs []*program
+		byDir    = make(map[string]*program)
+	)
+
+	for _, path := range paths {
+
+		// stat
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		dir := filepath.Clean(path)
+		if !info.IsDir() {
+			if filepath.Ext(path) != ".jack" {
+				return nil, fmt.Errorf("%s is not a jack file", path)
+			}
+			dir = filepath.Dir(dir)
+		}
+
+		dirs := []string{dir}
+		if info.IsDir() && recursive {
+			if dirs, err = programDirs(dir); err != nil {
+				return nil, err
+			}
+			if len(dirs) == 0 {
+				return nil, fmt.Errorf("no jack files found in %s", dir)
+			}
+		}
+
+		for _, dir := range dirs {
+			prg, ok := byDir[dir]
+			if !ok {
+				prg = &program{dir: dir}
+				byDir[dir] = prg
+				programs = append(programs, prg)
+			}
+
+			if info.IsDir() {
+				prg.whole = true
+			} else if !slices.Contains(prg.srcPaths, filepath.Clean(path)) {
+				prg.srcPaths = append(prg.srcPaths, filepath.Clean(path))
+			}
+		}
+	}
+
+	if err := mirror(programs); err != nil {
+		return nil, err
+	}
+
+	// all matching jack files within the folders
+	for _, prg := range programs {
+		matches, err := filepath.Glob(filepath.Join(prg.dir, "*.jack"))
+		if err != nil {
+			return nil, err
+		}
+		if prg.whole {
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no jack files found in %s", prg.dir)
+			}
+			prg.srcPaths = matches
+			continue
+		}
+		for _, match := range matches {
+			if !slices.Contains(prg.srcPaths, match) {
+				prg.declPaths = append(prg.declPaths, match)
+			}
+		}
+	}
+
+	return programs, nil
+}
+
+// programDirs folders with jack files below root (included), hidden folders are skipped
+func programDirs(root string) ([]string, error) {
+	var dirs []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			if filepath.Ext(path) == ".jack" && !slices.Contains(dirs, filepath.Dir(path)) {
+				dirs = append(dirs, filepath.Dir(path))
+			}
+			return nil
+		}
+		if path != root && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	slices.Sort(dirs)
+	return dirs, err
+}
+
+// mirror sets the output folder of the programs, the tree below the folder common to every program
+// is mirrored in the output directory (a single folder is written to the output directory itself)
+func mirror(programs []*program) error {
+	var root string
+	for i, prg := range programs {
+		dir, err := filepath.Abs(prg.dir)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			root = dir
+		}
+		for !isWithin(dir, root) {
+			root = filepath.Dir(root)
+		}
+	}
+	for _, prg := range programs {
+		dir, err := filepath.Abs(prg.dir)
+		if err != nil {
+			return err
+		}
+		if prg.outDir, err = filepath.Rel(root, dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isWithin reports whether path is dir or one of its descendants
+func isWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// vmPaths VM files of the folder not compiled from a jack file of the program (e.g. the OS)
+func (prg *program) vmPaths() ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(prg.dir, "*.vm"))
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(matches, func(vmPath string) bool {
+		return slices.Contains(prg.srcPaths, strings.TrimSuffix(vmPath, ".vm")+".jack")
+	}), nil
+}
+
+// compilation compiles the programs, rendering the diagnostics as the files are compiled. The
+// files are compiled concurrently by forks of the compilation, whose output is merged in order
+type compilation struct {
+	options
+	stdout       io.Writer // outputs written to stdout (-o -, fmt)
+	stderr       io.Writer // diagnostics and logs
+	renderer     *diag.Renderer
+	logger       *log.Logger
+	pool         pool
+	files        int // files compiled
+	failed       int // files with errors
+	errorCount   int // errors reported, the ones unrelated to the sources included
+	warningCount int // warnings reported
+}
+
+func newCompilation(opts options) *compilation {
+	jobs := opts.jobs
+	if jobs < 1 {
+		jobs = runtime.NumCPU()
+	}
+	if opts.debug {
+		// the symbol tables are printed as the files are compiled
+		jobs = 1
+	}
+	return &compilation{
+		options:  opts,
+		stdout:   os.Stdout,
+		stderr:   os.Stderr,
+		renderer: diag.NewRenderer(os.Stderr),
+		logger:   log.Default(),
+		pool:     make(pool, jobs),
+	}
+}
+
+// fork compilation of a part of the work, sharing the pool, its output is kept until merged
+func (c *compilation) fork() *compilation {
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	return &compilation{
+		options:  c.options,
+		stdout:   stdout,
+		stderr:   stderr,
+		renderer: diag.NewRenderer(stderr),
+		logger:   log.New(stderr, "", log.LstdFlags),
+		pool:     c.pool,
+	}
+}
+
+// merge writes the output of a fork and adds its counts
+func (c *compilation) merge(f *compilation) {
+	f.stdout.(*bytes.Buffer).WriteTo(c.stdout)
+	f.stderr.(*bytes.Buffer).WriteTo(c.stderr)
+	c.files += f.files
+	c.failed += f.failed
+	c.errorCount += f.errorCount
+	c.warningCount += f.warningCount
+}
+
+// parallel runs task for every path on the pool, the output of the tasks is merged in the order of
+// paths so it doesn't depend on which task ends first
+func (c *compilation) parallel(paths []string, task func(c *compilation, path string)) {
+	var (
+		forks = make([]*compilation, len(paths))
+		wg    sync.WaitGroup
+	)
+	for i, path := range paths {
+		forks[i] = c.fork()
+		wg.Go(func() {
+			c.pool.run(func() { task(forks[i], path) })
+		})
+	}
+	wg.Wait()
+	for _, f := range forks {
+		c.merge(f)
+	}
+}
+
+// pool limits the number of tasks running at once
+type pool chan struct{}
+
+// run runs task once a worker is free
+func (p pool) run(task func()) {
+	p <- struct{}{}
+	defer func() { <-p }()
+	task()
+}
+
+// buildAll builds every program, returning the exit code. The programs are built concurrently while
+// their output is written in order, as soon as the previous programs are done. In recursive mode a
+// summary of every program follows the diagnostics
+func (c *compilation) buildAll(programs []*program) int {
+	var (
+		results = make([]*compilation, len(programs))
+		done    = make([]chan struct{}, len(programs))
+	)
+	for i, prg := range programs {
+		// counted by program
+		results[i], done[i] = c.fork(), make(chan struct{})
+		go func() {
+			defer close(done[i])
+			results[i].build(prg)
+		}()
+	}
+	for i := range programs {
+		<-done[i]
+		c.merge(results[i])
+	}
+
+	if c.recursive {
+		c.summary(programs, results)
+	}
+
+	if c.failed > 0 {
+		c.logger.Printf("errors found in %d file(s)", c.failed)
+		return exitErrors
+	}
+	return exitOK
+}
+
+// summary prints a table with the counts of every program
+func (c *compilation) summary(programs []*program, results []*compilation) {
+	w := tabwriter.NewWriter(c.stderr, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "program\tfiles\terrors\twarnings")
+	row := func(name string, r *compilation) {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\n", name, r.files, r.errorCount, r.warningCount)
+	}
+	for i, prg := range programs {
+		row(prg.dir, results[i])
+	}
+	row(fmt.Sprintf("%d programs", len(programs)), c)
+	w.Flush()
+}
+
+func (c *compilation) build(prg *program) {
+	switch c.mode {
+	case compiler.VMOutput, compiler.AsmOutput:
+		c.compile(prg)
+	default:
+		c.parallel(prg.srcPaths, func(c *compilation, srcPath string) {
+			c.analyse(prg, srcPath)
+		})
+	}
+}
+
+// load collects the signatures of every class of the program (including the ones declared by
+// declPaths, the other VM files of the folder and the OS stubs), returning the files added
+func (c *compilation) load(prg *program) (*compiler.Program, []string, bool) {
+
+	cprg := compiler.NewProgram().
+		WithTypeCheck(c.typeCheck).
+		WithDropUnreachable(c.dropUnreachable).
+		WithShadowWarnings(c.warnings == warningsAll).
+		WithDebug(c.debug)
+
+	// custom OS
+	if c.osDir != "" {
+		if err := cprg.LoadOSStubs(c.osDir); err != nil {
+			c.fail(err)
+			return nil, nil, false
+		}
+	}
+
+	// collect all classes
+	parsed := make([]string, 0, len(prg.srcPaths))
+	for _, srcPath := range prg.srcPaths {
+		src, err := os.ReadFile(srcPath)
+		if err != nil {
+			c.fail(err)
+			continue
+		}
+		cprg.AddFile(srcPath, bytes.NewReader(src))
+		parsed = append(parsed, srcPath)
+	}
+	for _, declPath := range prg.declPaths {
+		if src, err := os.ReadFile(declPath); err == nil {
+			cprg.AddDeclarations(declPath, bytes.NewReader(src))
+		}
+	}
+
+	// prebuilt classes, loaded along with the program by run and -mode asm
+	vmPaths, err := prg.vmPaths()
+	if err != nil {
+		c.fail(err)
+		return nil, nil, false
+	}
+	for _, vmPath := range vmPaths {
+		if src, err := os.ReadFile(vmPath); err == nil {
+			if err := cprg.AddVMDeclarations(vmPath, bytes.NewReader(src)); err != nil {
+				c.fail(err)
+			}
+		}
+	}
+	return cprg, parsed, true
+}
+
+// compile compiles the files as a single program, the signatures of every class are collected
+// before the first file is compiled
+func (c *compilation) compile(prg *program) {
+	var (
+		cprg   *compiler.Program
+		parsed []string
+		ok     bool
+	)
+	c.pool.run(func() { cprg, parsed, ok = c.load(prg) })
+	if !ok {
+		return
+	}
+
+	if c.mode == compiler.AsmOutput {
+		c.assemble(prg, cprg, parsed)
+		return
+	}
+
+	// translate all files
+	c.parallel(parsed, func(c *compilation, srcPath string) {
+		dst, err := c.create(prg, srcPath, ".vm")
+		if err != nil {
+			c.fail(err)
+			return
+		}
+		c.finish(dst, c.report(cprg.Compile(srcPath, dst)))
+	})
+}
+
+// compileAll compiles the files of the program into memory, false when any of them has errors
+func (c *compilation) compileAll(cprg *compiler.Program, srcPaths []string) (map[string]*bytes.Buffer, bool) {
+	vmFiles := make(map[string]*bytes.Buffer)
+	for _, srcPath := range srcPaths {
+		vmFiles[srcPath] = new(bytes.Buffer)
+	}
+
+	failed := c.failed
+	c.parallel(srcPaths, func(c *compilation, srcPath string) {
+		c.report(cprg.Compile(srcPath, vmFiles[srcPath]))
+	})
+	return vmFiles, c.failed == failed
+}
+
+// assemble translates the VM code of the program to Hack assembly, a whole folder is written to a
+// single file starting with the bootstrap code and including the VM files of the folder not compiled
+// from a jack file (e.g. the OS)
+func (c *compilation) assemble(prg *program, cprg *compiler.Program, srcPaths []string) {
+
+	vmFiles, ok := c.compileAll(cprg, srcPaths)
+	if !ok {
+		return
+	}
+
+	translate := func(t *compiler.VMTranslator, path string, vm io.Reader) bool {
+		if err := t.Translate(baseName(path), vm); err != nil {
+			c.fail(err)
+			return false
+		}
+		return true
+	}
+
+	if !prg.whole {
+		for _, srcPath := range srcPaths {
+			dst, err := c.create(prg, srcPath, ".asm")
+			if err != nil {
+				c.fail(err)
+				continue
+			}
+			c.finish(dst, translate(compiler.NewVMTranslator(dst), srcPath, vmFiles[srcPath]))
+		}
+		return
+	}
+
+	// other VM files of the folder
+	vmPaths, err := prg.vmPaths()
+	if err != nil {
+		c.fail(err)
+		return
+	}
+
+	// named after the folder
+	absDir, err := filepath.Abs(prg.dir)
+	if err != nil {
+		c.fail(err)
+		return
+	}
+	dst, err := c.create(prg, filepath.Join(prg.dir, filepath.Base(absDir)), ".asm")
+	if err != nil {
+		c.fail(err)
+		return
+	}
+
+	t := compiler.NewVMTranslator(dst)
+	t.WriteBootstrap()
+	for _, srcPath := range srcPaths {
+		if !translate(t, srcPath, vmFiles[srcPath]) {
+			c.finish(dst, false)
+			return
+		}
+	}
+	for _, vmPath := range vmPaths {
+		vm, err := os.Open(vmPath)
+		if err != nil {
+			c.fail(err)
+			c.finish(dst, false)
+			return
+		}
+		ok := translate(t, vmPath, vm)
+		vm.Close()
+		if !ok {
+			c.finish(dst, false)
+			return
+		}
+	}
+	c.finish(dst, true)
+}
+
+// analyse runs the analyser on a single file (tokens, xml and ast modes)
+func (c *compilation) analyse(prg *program, srcPath string) {
+
+	// open src file
+	srcFile, err := os.Open(srcPath)
+	if err != nil {
+		c.fail(err)
+		return
+	}
+	defer srcFile.Close()
+
+	// tokens are written to FileNameT.xml (project 10 convention)
+	ext := "." + string(c.mode)
+	switch c.mode {
+	case compiler.TokensOutput:
+		ext = "T.xml"
+	case compiler.XMLOutput:
+		ext = ".xml"
+	}
+
+	dst, err := c.create(prg, srcPath, ext)
+	if err != nil {
+		c.fail(err)
+		return
+	}
+
+	// run the analyser
+	anlzr := compiler.NewJackAnalyser(srcFile, dst).
+		WithFileName(srcPath).
+		WithMode(c.mode).
+		WithTypeCheck(c.typeCheck).
+		WithDebug(c.debug)
+	err = anlzr.Run()
+	ok := c.report(anlzr.Diagnostics())
+	if err != nil && !errors.As(err, new(diag.List)) {
+		c.fail(err)
+	}
+	c.finish(dst, ok && err == nil)
+}
+
+// create opens the output of a source file, in the output directory (mirroring the tree of the
+// sources) or next to the source
+func (c *compilation) create(prg *program, srcPath, ext string) (*output, error) {
+	if c.discard {
+		return &output{Writer: io.Discard, path: "-"}, nil
+	}
+	if c.outDir == "-" {
+		buffer := new(bytes.Buffer)
+		return &output{Writer: buffer, path: "-", buffer: buffer, stdout: c.stdout}, nil
+	}
+
+	dir := filepath.Dir(srcPath)
+	if c.outDir != "" {
+		dir = filepath.Join(c.outDir, prg.outDir)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+	return newOutput(filepath.Join(dir, baseName(srcPath)+ext), 0o644)
+}
+
+// finish keeps the output when it was written successfully, discarding it otherwise. The output
+// of a previous build would then be used as if it was up to date: it's removed from the -o
+// directory, which only holds outputs, while next to the sources it's left alone with a warning
+func (c *compilation) finish(dst *output, ok bool) {
+	if !ok {
+		dst.discard()
+		if dst.path == "-" {
+			return
+		}
+		if c.outDir == "" {
+			if _, err := os.Stat(dst.path); err == nil {
+				c.logger.Printf("warning: %s is stale, it's the output of a previous build\n", dst.path)
+			}
+			return
+		}
+		if err := os.Remove(dst.path); err == nil {
+			c.logger.Printf("removed %s, the output of a previous build\n", dst.path)
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			c.logger.Println(err)
+		}
+		return
+	}
+	if err := dst.commit(); err != nil {
+		c.fail(err)
+		return
+	}
+	c.done(dst.path)
+}
+
+// report renders the diagnostics of a file according to the warnings level, returning false
+// when the file has errors
+func (c *compilation) report(diagnostics diag.List) bool {
+	c.files++
+
+	shown := make(diag.List, 0, len(diagnostics))
+	for _, d := range diagnostics {
+		if d.Severity == diag.Warning {
+			switch c.warnings {
+			case warningsNone:
+				continue
+			case warningsError:
+				d.Severity = diag.Error
+			}
+		}
+		shown = append(shown, d)
+	}
+	c.renderer.RenderAll(shown)
+	for _, d := range shown {
+		if d.Severity == diag.Error {
+			c.errorCount++
+		} else if d.Severity == diag.Warning {
+			c.warningCount++
+		}
+	}
+
+	if shown.Err() != nil {
+		c.failed++
+		return false
+	}
+	return true
+}
+
+// fail reports an error unrelated to the sources (e.g. I/O)
+func (c *compilation) fail(err error) {
+	c.logger.Println(err)
+	c.failed++
+	c.errorCount++
+}
+
+// done logs the output written
+func (c *compilation) done(dstPath string) {
+	if dstPath != "-" {
+		c.logger.Printf("JACK Compiler finished successfully, output to %s\n", dstPath)
+	}
+}
+
+// baseName file name without its folder and extension
+func baseName(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+}
+
+// output file being written, the content goes to a temporary file of the same folder renamed to
+// path when committed so a failed compilation never leaves a partial file behind. Outputs to stdout
+// are buffered until committed for the same reason
+type output struct {
+	io.Writer
+	path   string
+	file   *os.File // temporary file, nil for stdout
+	perm   os.FileMode
+	buffer *bytes.Buffer // content written to stdout, nil for files
+	stdout io.Writer
+}
+
+func newOutput(path string, perm os.FileMode) (*output, error) {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	return &output{Writer: file, path: path, file: file, perm: perm}, nil
+}
+
+// commit replaces the file at path with the content written (or writes it to stdout)
+func (o *output) commit() error {
+	if o.buffer != nil {
+		_, err := o.buffer.WriteTo(o.stdout)
+		return err
+	}
+	if o.file == nil {
+		return nil
+	}
+	err := o.file.Chmod(o.perm)
+	if closeErr := o.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(o.file.Name(), o.path)
+	}
+	if err != nil {
+		os.Remove(o.file.Name())
+	}
+	return err
+}
+
+// discard removes the content written, an existing file at path is left untouched
+func (o *output) discard() {
+	if o.buffer != nil {
+		o.buffer.Reset()
+	}
+	if o.file != nil {
+		o.file.Close()
+		os.Remove(o.file.Name())
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// compareOutputs compares every file of want with the file of the same name in dir
+func compareOutputs(t *testing.T, want []string, dir string) {
+	t.Helper()
+	if len(want) == 0 {
+		t.Fatal("no expected output found")
+	}
+	for _, wantPath := range want {
+		wantContent, err := os.ReadFile(wantPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(filepath.Join(dir, filepath.Base(wantPath)))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if string(got) != string(wantContent) {
+			t.Errorf("%s differs from %s", filepath.Base(wantPath), wantPath)
+		}
+	}
+}
+
+func TestBuild(t *testing.T) {
+	dirs, err := filepath.Glob("testdata/compiler/*/A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range dirs {
+		t.Run(dir, func(t *testing.T) {
+			out := t.TempDir()
+			if code := run([]string{"build", "-o", out, dir}); code != exitOK {
+				t.Fatalf("exit code %d", code)
+			}
+			want, _ := filepath.Glob(filepath.Join(dir, "*.vm"))
+			compareOutputs(t, want, out)
+		})
+	}
+}
+
+// TestBuildMirror builds two programs at once, the output directory mirrors their tree
+func TestBuildMirror(t *testing.T) {
+	out := t.TempDir()
+	if code := run([]string{"build", "-o", out, "testdata/compiler/Seven/A", "testdata/compiler/Pong/A"}); code != exitOK {
+		t.Fatalf("exit code %d", code)
+	}
+	for _, dir := range []string{"Seven/A", "Pong/A"} {
+		want, _ := filepath.Glob(filepath.Join("testdata/compiler", dir, "*.vm"))
+		compareOutputs(t, want, filepath.Join(out, dir))
+	}
+}
+
+// TestBuildRecursive builds every program of testdata/compiler at once, one after the other and
+// concurrently
+func TestBuildRecursive(t *testing.T) {
+	for _, jobs := range []string{"1", "4"} {
+		t.Run("-j "+jobs, func(t *testing.T) {
+			out := t.TempDir()
+			if code := run([]string{"build", "-r", "-j", jobs, "-o", out, "testdata/compiler"}); code != exitOK {
+				t.Fatalf("exit code %d", code)
+			}
+			dirs, _ := filepath.Glob("testdata/compiler/*/A")
+			for _, dir := range dirs {
+				want, _ := filepath.Glob(filepath.Join(dir, "*.vm"))
+				rel, _ := filepath.Rel("testdata/compiler", dir)
+				compareOutputs(t, want, filepath.Join(out, rel))
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	out := t.TempDir()
+	if code := run([]string{"parse", "-o", out, "testdata/analyzer"}); code != exitOK {
+		t.Fatalf("exit code %d", code)
+	}
+	want, _ := filepath.Glob("testdata/analyzer/*.xml")
+	compareOutputs(t, want, out)
+}
+
+// TestTokens compares the tokens with the terminals of the parse trees of testdata/analyzer
+func TestTokens(t *testing.T) {
+	out := t.TempDir()
+	if code := run([]string{"tokens", "-o", out, "testdata/analyzer"}); code != exitOK {
+		t.Fatalf("exit code %d", code)
+	}
+
+	terminal := regexp.MustCompile(`^\s*<(keyword|symbol|identifier|integerConstant|stringConstant)> (.*) </\w+>$`)
+	trees, _ := filepath.Glob("testdata/analyzer/*.xml")
+	for _, tree := range trees {
+		content, err := os.ReadFile(tree)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var want strings.Builder
+		want.WriteString("<tokens>")
+		for line := range strings.SplitSeq(string(content), "\n") {
+			if m := terminal.FindStringSubmatch(strings.TrimRight(line, "\r")); m != nil {
+				want.WriteString("<" + m[1] + ">" + m[2] + "</" + m[1] + ">\n")
+			}
+		}
+		want.WriteString("</tokens>")
+
+		tokensPath := filepath.Join(out, baseName(tree)+"T.xml")
+		got, err := os.ReadFile(tokensPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want.String() {
+			t.Errorf("the tokens of %s differ from the terminals of %s", tokensPath, tree)
+		}
+	}
+}
+
+func TestBuildErrors(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "Main.jack")
+	write := func(vars, body string) {
+		t.Helper()
+		if err := os.WriteFile(src, []byte("class Main {\n    function void main() {\n"+vars+body+"        return;\n    }\n}\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("", "")
+	if code := run([]string{"build", dir}); code != exitOK {
+		t.Fatalf("exit code %d, want %d", code, exitOK)
+	}
+	vm := filepath.Join(dir, "Main.vm")
+	if _, err := os.Stat(vm); err != nil {
+		t.Fatal(err)
+	}
+
+	// the output of the previous build is left next to the sources, but removed from -o
+	out := t.TempDir()
+	if code := run([]string{"build", "-o", out, dir}); code != exitOK {
+		t.Fatalf("exit code %d, want %d", code, exitOK)
+	}
+	write("", "        do Output.printInt(1, 2);\n")
+	if code := run([]string{"build", dir}); code != exitErrors {
+		t.Errorf("exit code %d, want %d", code, exitErrors)
+	}
+	if _, err := os.Stat(vm); err != nil {
+		t.Errorf("%s removed after a failed build: %v", vm, err)
+	}
+	if code := run([]string{"build", "-o", out, dir}); code != exitErrors {
+		t.Errorf("exit code %d, want %d", code, exitErrors)
+	}
+	if _, err := os.Stat(filepath.Join(out, "Main.vm")); !os.IsNotExist(err) {
+		t.Errorf("%s left after a failed build", filepath.Join(out, "Main.vm"))
+	}
+	if code := run([]string{"check", dir}); code != exitErrors {
+		t.Errorf("check exit code %d, want %d", code, exitErrors)
+	}
+
+	// warnings only fail the build with -warnings error
+	write("        var int x;\n", "")
+	if code := run([]string{"build", dir}); code != exitOK {
+		t.Errorf("exit code %d, want %d", code, exitOK)
+	}
+	if code := run([]string{"build", "-warnings", "error", dir}); code != exitErrors {
+		t.Errorf("-warnings error: exit code %d, want %d", code, exitErrors)
+	}
+}
+
+// TestBuildWithVMFiles builds a folder holding a prebuilt VM file along with the jack files, the
+// classes of the VM file are known to the compiler
+func TestBuildWithVMFiles(t *testing.T) {
+	dir := t.TempDir()
+	helper := "function Helper.twice 0\npush argument 0\npush argument 0\nadd\nreturn\n"
+	if err := os.WriteFile(filepath.Join(dir, "Helper.vm"), []byte(helper), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	write := func(call string) {
+		t.Helper()
+		src := "class Main {\n    function void main() {\n        do Output.printInt(" + call + ");\n        return;\n    }\n}\n"
+		if err := os.WriteFile(filepath.Join(dir, "Main.jack"), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("Helper.twice(21)")
+	for _, args := range [][]string{
+		{"build", dir},
+		{"build", "-mode", "asm", "-o", t.TempDir(), dir},
+		{"build", filepath.Join(dir, "Main.jack")},
+	} {
+		if code := run(args); code != exitOK {
+			t.Errorf("%q: exit code %d, want %d", args, code, exitOK)
+		}
+	}
+
+	write("Helper.thrice(21)")
+	if code := run([]string{"check", dir}); code != exitErrors {
+		t.Errorf("unknown function: exit code %d, want %d", code, exitErrors)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	for _, args := range [][]string{
+		nil,
+		{"build"},
+		{"build", "-warnings", "some", "testdata/compiler/Seven/A"},
+		{"check", "-typecheck", "very", "testdata/compiler/Seven/A"},
+		{"build", "-mode", "bin", "testdata/compiler/Seven/A"},
+		{"build", "testdata/compiler/Missing"},
+		{"build", "-j", "-1", "testdata/compiler/Seven/A"},
+	} {
+		if code := run(args); code != exitUsage {
+			t.Errorf("%q: exit code %d, want %d", args, code, exitUsage)
+		}
+	}
+}
@@ -1,27 +1,110 @@
 package compiler
 
 import (
+	"bytes"
 	"encoding/xml"
 	"fmt"
 	"io"
-	"os"
+	"path/filepath"
 	"strings"
+
+	"github.com/Dudssource/dd-jack-compiler/compiler/ast"
+	"github.com/Dudssource/dd-jack-compiler/compiler/diag"
 )
 
+// OutputMode selects what the analyser writes to the destination
+type OutputMode string
+
+const (
+	// VMOutput compiled VM code (project 11)
+	VMOutput OutputMode = "vm"
+	// XMLOutput parse tree XML (project 10 analyzer)
+	XMLOutput OutputMode = "xml"
+	// TokensOutput tokenizer XML (project 10 tokenizer)
+	TokensOutput OutputMode = "tokens"
+	// ASTOutput syntax tree, see ast.Fprint
+	ASTOutput OutputMode = "ast"
+	// AsmOutput Hack assembly of the VM code (projects 7 and 8), see VMTranslator
+	AsmOutput OutputMode = "asm"
+)
+
+// OutputModes every output mode, in the order of the usage
+var OutputModes = []OutputMode{VMOutput, TokensOutput, XMLOutput, AsmOutput, ASTOutput}
+
 type JackAnalyser struct {
-	tknzr   *jackTokenizer
-	dstFile io.Writer
+	tknzr           *jackTokenizer
+	dstFile         io.Writer
+	mode            OutputMode
+	fileName        string
+	typeCheck       TypeCheckLevel
+	dropUnreachable bool
+	warnShadow      bool
+	checkFileName   bool
+	debug           bool
+	diagnostics     diag.List
 }
 
 func NewJackAnalyser(srcFile io.Reader, dstFile io.Writer) *JackAnalyser {
 	return &JackAnalyser{
-		tknzr:   newTokenizer(srcFile),
-		dstFile: dstFile,
+		tknzr:         newTokenizer(srcFile),
+		dstFile:       dstFile,
+		mode:          VMOutput,
+		checkFileName: true,
 	}
 }
 
+// WithFileName sets the name of the source file, reported by the diagnostics
+func (anlzr *JackAnalyser) WithFileName(fileName string) *JackAnalyser {
+	anlzr.fileName = fileName
+	return anlzr
+}
+
+// WithMode changes the output mode (VM code by default)
+func (anlzr *JackAnalyser) WithMode(mode OutputMode) *JackAnalyser {
+	anlzr.mode = mode
+	return anlzr
+}
+
+// WithTypeCheck enables the type checker (disabled by default), only classes of the file and of
+// the Jack OS are known
+func (anlzr *JackAnalyser) WithTypeCheck(level TypeCheckLevel) *JackAnalyser {
+	anlzr.typeCheck = level
+	return anlzr
+}
+
+// WithDropUnreachable leaves the unreachable statements out of the VM code
+func (anlzr *JackAnalyser) WithDropUnreachable(drop bool) *JackAnalyser {
+	anlzr.dropUnreachable = drop
+	return anlzr
+}
+
+// WithShadowWarnings warns about locals and parameters shadowing a field or a static
+func (anlzr *JackAnalyser) WithShadowWarnings(enabled bool) *JackAnalyser {
+	anlzr.warnShadow = enabled
+	return anlzr
+}
+
+// WithFileNameCheck enables (default) or disables the check of the class name against the file
+// name given to WithFileName, to be disabled when the source is not a file (e.g. stdin)
+func (anlzr *JackAnalyser) WithFileNameCheck(enabled bool) *JackAnalyser {
+	anlzr.checkFileName = enabled
+	return anlzr
+}
+
+// WithDebug prints the symbol tables to stdout while compiling
+func (anlzr *JackAnalyser) WithDebug(enabled bool) *JackAnalyser {
+	anlzr.debug = enabled
+	return anlzr
+}
+
+// Diagnostics every error and warning reported by the last run
+func (anlzr *JackAnalyser) Diagnostics() diag.List {
+	return anlzr.diagnostics
+}
+
+// Run compiles the source, the returned error is a diag.List when the source has errors
 func (anlzr *JackAnalyser) Run() error {
-	if strings.EqualFold(os.Getenv("JACK_DUMP_TOKENS"), "true") {
+	if anlzr.mode == TokensOutput {
 		fmt.Fprint(anlzr.dstFile, "<tokens>")
 		for token, hasNext := anlzr.tknzr.getNextToken(); hasNext; token, hasNext = anlzr.tknzr.getNextToken() {
 			fmt.Fprintf(anlzr.dstFile, "<%s>", token.lex)
@@ -29,7 +112,65 @@ func (anlzr *JackAnalyser) Run() error {
 			fmt.Fprintf(anlzr.dstFile, "</%s>\n", token.lex)
 		}
 		fmt.Fprint(anlzr.dstFile, "</tokens>")
-		return nil
+		anlzr.report(anlzr.tknzr.diagnostics)
+		return anlzr.diagnostics.Err()
+	}
+
+	// parse the class into its syntax tree
+	class, diagnostics := newParser(anlzr.tknzr).parse()
+	if anlzr.report(diagnostics) != nil {
+		return anlzr.diagnostics.Err()
+	}
+
+	switch anlzr.mode {
+	case XMLOutput:
+		newXMLWriter(anlzr.dstFile).writeClass(class)
+	case ASTOutput:
+		if err := ast.Fprint(anlzr.dstFile, class); err != nil {
+			return err
+		}
+	case AsmOutput:
+		// no bootstrap, a single file is not a program
+		var vm bytes.Buffer
+		if anlzr.compile(class, &vm) == nil {
+			base := filepath.Base(anlzr.fileName)
+			return NewVMTranslator(anlzr.dstFile).Translate(strings.TrimSuffix(base, filepath.Ext(base)), &vm)
+		}
+	case VMOutput:
+		anlzr.compile(class, anlzr.dstFile)
+	default:
+		return fmt.Errorf("unknown output mode %s", anlzr.mode)
 	}
-	return newCompilationEngine(anlzr.tknzr, anlzr.dstFile).compile()
+
+	return anlzr.diagnostics.Err()
+}
+
+// compile writes the VM code of the class
+func (anlzr *JackAnalyser) compile(class *ast.Class, dstFile io.Writer) error {
+	// a single file, other classes of the program are unknown
+	if anlzr.checkFileName {
+		if d := checkFileName(anlzr.fileName, class); d != nil {
+			anlzr.report(diag.List{d})
+		}
+	}
+	index := newProgramIndex(false)
+	index.add(anlzr.fileName, class)
+	checked := newTypeChecker(anlzr.typeCheck, index).check(class)
+	engine := newCompilationEngine(dstFile, index)
+	engine.dropUnreachable = anlzr.dropUnreachable
+	engine.warnShadow = anlzr.warnShadow
+	engine.isDebugEnabled = anlzr.debug
+	// the type checker and the engine each walk the whole class
+	compiled := append(checked, engine.compile(class)...)
+	compiled.Sort()
+	anlzr.report(compiled)
+
+	return anlzr.diagnostics.Err()
+}
+
+// report records the diagnostics of a phase, returning an error if any of them is an error
+func (anlzr *JackAnalyser) report(diagnostics diag.List) error {
+	diagnostics.SetFile(anlzr.fileName)
+	anlzr.diagnostics = append(anlzr.diagnostics, diagnostics...)
+	return diagnostics.Err()
 }
@@ -0,0 +1,131 @@
+package compiler
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestCompile compiles every jack file of the A folders of testdata/compiler and compares the VM code
+// with the VM file next to it
+func TestCompile(t *testing.T) {
+	paths, err := filepath.Glob("../testdata/compiler/*/A/*.jack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no jack files found in testdata")
+	}
+	for _, path := range paths {
+		t.Run(path, func(t *testing.T) {
+			src, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := os.ReadFile(strings.TrimSuffix(path, ".jack") + ".vm")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var vm strings.Builder
+			if err := NewJackAnalyser(strings.NewReader(string(src)), &vm).Run(); err != nil {
+				t.Fatal(err)
+			}
+			if vm.String() != string(want) {
+				t.Errorf("the VM code of %s differs from the expected one", path)
+			}
+		})
+	}
+}
+
+// TestParseTree compares the parse trees of the jack files of testdata/analyzer with the XML files next
+// to them
+func TestParseTree(t *testing.T) {
+	paths, err := filepath.Glob("../testdata/analyzer/*.jack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no jack files found in testdata")
+	}
+	for _, path := range paths {
+		t.Run(path, func(t *testing.T) {
+			src, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := os.ReadFile(strings.TrimSuffix(path, ".jack") + ".xml")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var xml strings.Builder
+			if err := NewJackAnalyser(strings.NewReader(string(src)), &xml).WithMode(XMLOutput).Run(); err != nil {
+				t.Fatal(err)
+			}
+			if xml.String() != string(want) {
+				t.Errorf("the parse tree of %s differs from the expected one", path)
+			}
+		})
+	}
+}
+
+// TestSyntaxTree compares the syntax trees of the jack files of testdata/compiler having an AST file
+// next to them (printed by ast.Fprint)
+func TestSyntaxTree(t *testing.T) {
+	paths, err := filepath.Glob("../testdata/compiler/*/A/*.ast")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no AST files found in testdata")
+	}
+	for _, path := range paths {
+		t.Run(path, func(t *testing.T) {
+			src, err := os.ReadFile(strings.TrimSuffix(path, ".ast") + ".jack")
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var tree strings.Builder
+			if err := NewJackAnalyser(strings.NewReader(string(src)), &tree).WithMode(ASTOutput).Run(); err != nil {
+				t.Fatal(err)
+			}
+			if tree.String() != string(want) {
+				t.Errorf("the syntax tree of %s differs from the expected one", path)
+			}
+		})
+	}
+}
+
+func TestFoldMinInt(t *testing.T) {
+	var vm strings.Builder
+	if err := NewJackAnalyser(strings.NewReader(mainClass("        var int x;", "        let x = -32768;")), &vm).Run(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(vm.String(), "\tpush constant 32767\n\tnot\n\tpop local 0\n") {
+		t.Errorf("-32768 is not folded, got\n%s", vm.String())
+	}
+}
+
+// TestDiagnosticsOrder compares the diagnostics of a single file with the ones of the same file
+// compiled as a program, both sorted by position
+func TestDiagnosticsOrder(t *testing.T) {
+	src := mainClass("        var boolean b;", "        do Main.draw();\n        let b = 1;\n        do Output.printInt(b);")
+	anlzr := NewJackAnalyser(strings.NewReader(src), io.Discard).WithFileName("Main.jack").WithTypeCheck(TypeCheckLoose)
+	if err := anlzr.Run(); err == nil {
+		t.Fatal("no error reported")
+	}
+	var got []string
+	for _, d := range anlzr.Diagnostics() {
+		got = append(got, d.Error())
+	}
+	want := compileProgram(TypeCheckLoose, "Main.jack", src)
+	if !slices.Equal(got, want) {
+		t.Errorf("got diagnostics\n\t%s\nwant\n\t%s", strings.Join(got, "\n\t"), strings.Join(want, "\n\t"))
+	}
+}
@@ -0,0 +1,173 @@
+package compiler
+
+import (
+	"maps"
+
+	"github.com/Dudssource/dd-jack-compiler/compiler/ast"
+	"github.com/Dudssource/dd-jack-compiler/compiler/diag"
+)
+
+// assignments locals assigned on every path (definite) and on at least one path (maybe) reaching
+// a statement
+type assignments struct {
+	definite map[string]bool
+	maybe    map[string]bool
+}
+
+func (a assignments) clone() assignments {
+	return assignments{definite: maps.Clone(a.definite), maybe: maps.Clone(a.maybe)}
+}
+
+func (a assignments) assign(name string) {
+	a.definite[name] = true
+	a.maybe[name] = true
+}
+
+// merge joins the paths of two branches
+func (a assignments) merge(other assignments) assignments {
+	merged := assignments{definite: make(map[string]bool), maybe: maps.Clone(a.maybe)}
+	for name := range a.definite {
+		if other.definite[name] {
+			merged.definite[name] = true
+		}
+	}
+	maps.Copy(merged.maybe, other.maybe)
+	return merged
+}
+
+// assignmentChecker reports locals read before any let assigned them, locals aren't guaranteed to
+// start at 0 on every VM implementation
+type assignmentChecker struct {
+	locals      map[string]*ast.Ident // declaration of every local of the subroutine
+	reported    map[string]bool       // a single report per local
+	silent      bool                  // nothing is reported, see loopEntry
+	diagnostics diag.List
+}
+
+// checkAssignments runs the definite assignment analysis on the locals of a subroutine
+func checkAssignments(dec *ast.SubroutineDec) diag.List {
+	ac := &assignmentChecker{
+		locals:   make(map[string]*ast.Ident),
+		reported: make(map[string]bool),
+	}
+	params := make(map[string]bool)
+	for _, param := range dec.Params {
+		params[param.Name.Name] = true
+	}
+	for _, varDec := range dec.Body.Vars {
+		for _, name := range varDec.Names {
+			if _, ok := ac.locals[name.Name]; !ok && !params[name.Name] {
+				ac.locals[name.Name] = name
+			}
+		}
+	}
+	if len(ac.locals) == 0 {
+		return nil
+	}
+
+	ac.statements(dec.Body.Statements, assignments{definite: make(map[string]bool), maybe: make(map[string]bool)})
+	return ac.diagnostics
+}
+
+// statements returns the assignments at the end of the statements and true when every path returns
+func (ac *assignmentChecker) statements(stmts []ast.Stmt, in assignments) (assignments, bool) {
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *ast.LetStmt:
+			if s.Index != nil {
+				ac.read(s.Name, in)
+				ac.expression(s.Index, in)
+			}
+			ac.expression(s.Value, in)
+			if s.Index == nil {
+				in.assign(s.Name.Name)
+			}
+		case *ast.IfStmt:
+			ac.expression(s.Cond, in)
+			thenOut, thenReturns := ac.statements(s.Then, in.clone())
+			elseOut, elseReturns := ac.statements(s.Else, in.clone())
+			switch {
+			case thenReturns && elseReturns:
+				return in, true
+			case thenReturns:
+				in = elseOut
+			case elseReturns:
+				in = thenOut
+			default:
+				in = thenOut.merge(elseOut)
+			}
+		case *ast.WhileStmt:
+			// the condition and the body are reached from before the loop and from the end of the
+			// previous iteration (the back edge), the body may not run at all
+			in = ac.loopEntry(s.Body, in)
+			ac.expression(s.Cond, in)
+			bodyOut, _ := ac.statements(s.Body, in.clone())
+			if isTrue(s.Cond) {
+				return bodyOut, true
+			}
+		case *ast.DoStmt:
+			ac.expression(s.Call, in)
+		case *ast.ReturnStmt:
+			if s.Value != nil {
+				ac.expression(s.Value, in)
+			}
+			// the following statements are unreachable
+			return in, true
+		}
+	}
+	return in, false
+}
+
+// loopEntry merges the assignments before a loop with the ones at the end of its body until
+// they no longer change, nothing is reported meanwhile
+func (ac *assignmentChecker) loopEntry(body []ast.Stmt, in assignments) assignments {
+	silent := ac.silent
+	ac.silent = true
+	defer func() { ac.silent = silent }()
+
+	for {
+		bodyOut, returns := ac.statements(body, in.clone())
+		if returns {
+			// no path gets back to the condition
+			return in
+		}
+		merged := in.merge(bodyOut)
+		if len(merged.definite) == len(in.definite) && len(merged.maybe) == len(in.maybe) {
+			return merged
+		}
+		in = merged
+	}
+}
+
+func (ac *assignmentChecker) expression(expr ast.Expr, in assignments) {
+	ast.Inspect(expr, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.VarRef:
+			ac.read(n.Name, in)
+		case *ast.IndexExpr:
+			ac.read(n.Name, in)
+		case *ast.CallExpr:
+			if n.Receiver != nil {
+				ac.read(n.Receiver, in)
+			}
+		}
+		return true
+	})
+}
+
+// read reports a local that may not be assigned yet
+func (ac *assignmentChecker) read(name *ast.Ident, in assignments) {
+	decl, ok := ac.locals[name.Name]
+	if !ok || ac.silent || in.definite[name.Name] || ac.reported[name.Name] {
+		return
+	}
+	ac.reported[name.Name] = true
+
+	d := diag.Warnf(ast.SpanOf(name), "%s is used before being assigned", name.Name)
+	if in.maybe[name.Name] {
+		d.Message = name.Name + " may be used before being assigned"
+	}
+	ac.diagnostics = append(ac.diagnostics,
+		d.WithHelp("locals don't start at 0 on every VM, assign %s with 'let' first", name.Name).
+			WithNote("", ast.SpanOf(decl), "%s is declared here", name.Name))
+}
@@ -0,0 +1,338 @@
+// Package ast declares the types used to represent the syntax tree of a Jack class.
+package ast
+
+import (
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+)
+
+// Pos position within the source file, Offset is zero based (bytes) while Line and Column
+// are one based (Column counts characters)
+type Pos struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+func (p Pos) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// IsValid reports whether the position was set
+func (p Pos) IsValid() bool {
+	return p.Line > 0
+}
+
+// Shift position right after text starting at p (text must not span lines)
+func (p Pos) Shift(text string) Pos {
+	return Pos{
+		Offset: p.Offset + len(text),
+		Line:   p.Line,
+		Column: p.Column + utf8.RuneCountInString(text),
+	}
+}
+
+// Span range of the source file, End is exclusive
+type Span struct {
+	Start Pos
+	End   Pos
+}
+
+func (s Span) String() string {
+	return fmt.Sprintf("%s-%s", s.Start, s.End)
+}
+
+// SpanOf returns the span covered by the node
+func SpanOf(n Node) Span {
+	return Span{Start: n.Pos(), End: n.End()}
+}
+
+// Node every node in the tree reports the position of its first token and the position
+// right after its last token
+type Node interface {
+	Pos() Pos
+	End() Pos
+}
+
+// Stmt any of the jack statements (let, if, while, do, return)
+type Stmt interface {
+	Node
+	stmtNode()
+}
+
+// Expr any jack expression or term
+type Expr interface {
+	Node
+	exprNode()
+}
+
+// Ident identifier (varName, className, subroutineName or type)
+type Ident struct {
+	NamePos Pos
+	Name    string
+}
+
+func (i *Ident) Pos() Pos { return i.NamePos }
+func (i *Ident) End() Pos { return i.NamePos.Shift(i.Name) }
+
+// IsPrimitive reports whether the identifier names one of the builtin types (int, char, boolean) or void
+func (i *Ident) IsPrimitive() bool {
+	switch i.Name {
+	case "int", "char", "boolean", "void":
+		return true
+	}
+	return false
+}
+
+// Comment line (// ...) or block (/* ... */) comment, Text includes the delimiters
+type Comment struct {
+	Slash    Pos
+	Text     string
+	EndPos   Pos
+	Trailing bool // follows code on the same line
+}
+
+func (c *Comment) Pos() Pos { return c.Slash }
+func (c *Comment) End() Pos { return c.EndPos }
+
+// Class 'class' className '{' classVarDec* subroutineDec* '}'
+type Class struct {
+	ClassPos    Pos
+	Name        *Ident
+	Vars        []*ClassVarDec
+	Subroutines []*SubroutineDec
+	Rbrace      Pos
+	Comments    []*Comment // every comment of the file, in order
+}
+
+func (c *Class) Pos() Pos { return c.ClassPos }
+func (c *Class) End() Pos { return c.Rbrace.Shift("}") }
+
+// ClassVarDec ('static'|'field') type varName (',' varName)* ';'
+type ClassVarDec struct {
+	KindPos   Pos
+	Kind      string
+	Type      *Ident
+	Names     []*Ident
+	Semicolon Pos
+}
+
+func (d *ClassVarDec) Pos() Pos { return d.KindPos }
+func (d *ClassVarDec) End() Pos { return d.Semicolon.Shift(";") }
+
+// SubroutineDec ('constructor'|'function'|'method') ('void'|type) subroutineName '(' parameterList ')' subroutineBody
+type SubroutineDec struct {
+	KindPos    Pos
+	Kind       string
+	ReturnType *Ident
+	Name       *Ident
+	Params     []*Param
+	Body       *SubroutineBody
+}
+
+func (d *SubroutineDec) Pos() Pos { return d.KindPos }
+func (d *SubroutineDec) End() Pos { return d.Body.End() }
+
+// Param type varName
+type Param struct {
+	Type *Ident
+	Name *Ident
+}
+
+func (p *Param) Pos() Pos { return p.Type.Pos() }
+func (p *Param) End() Pos { return p.Name.End() }
+
+// SubroutineBody '{' varDec* statements '}'
+type SubroutineBody struct {
+	Lbrace     Pos
+	Vars       []*VarDec
+	Statements []Stmt
+	Rbrace     Pos
+}
+
+func (b *SubroutineBody) Pos() Pos { return b.Lbrace }
+func (b *SubroutineBody) End() Pos { return b.Rbrace.Shift("}") }
+
+// VarDec 'var' type varName (',' varName)* ';'
+type VarDec struct {
+	VarPos    Pos
+	Type      *Ident
+	Names     []*Ident
+	Semicolon Pos
+}
+
+func (d *VarDec) Pos() Pos { return d.VarPos }
+func (d *VarDec) End() Pos { return d.Semicolon.Shift(";") }
+
+// LetStmt 'let' varName ('[' expression ']')? '=' expression ';'
+type LetStmt struct {
+	LetPos    Pos
+	Name      *Ident
+	Index     Expr // nil unless array assignment
+	Value     Expr
+	Semicolon Pos
+}
+
+// IfStmt 'if' '(' expression ')' '{' statements '}' ('else' '{' statements '}')?
+type IfStmt struct {
+	IfPos      Pos
+	Cond       Expr
+	Then       []Stmt
+	ThenRbrace Pos // closing brace of the then block
+	HasElse    bool
+	ElsePos    Pos
+	Else       []Stmt
+	Rbrace     Pos // closing brace of the last block
+}
+
+// WhileStmt 'while' '(' expression ')' '{' statements '}'
+type WhileStmt struct {
+	WhilePos Pos
+	Cond     Expr
+	Body     []Stmt
+	Rbrace   Pos
+}
+
+// DoStmt 'do' subroutineCall ';'
+type DoStmt struct {
+	DoPos     Pos
+	Call      *CallExpr
+	Semicolon Pos
+}
+
+// ReturnStmt 'return' expression? ';'
+type ReturnStmt struct {
+	ReturnPos Pos
+	Value     Expr // nil for a bare return
+	Semicolon Pos
+}
+
+func (s *LetStmt) Pos() Pos    { return s.LetPos }
+func (s *IfStmt) Pos() Pos     { return s.IfPos }
+func (s *WhileStmt) Pos() Pos  { return s.WhilePos }
+func (s *DoStmt) Pos() Pos     { return s.DoPos }
+func (s *ReturnStmt) Pos() Pos { return s.ReturnPos }
+
+func (s *LetStmt) End() Pos    { return s.Semicolon.Shift(";") }
+func (s *IfStmt) End() Pos     { return s.Rbrace.Shift("}") }
+func (s *WhileStmt) End() Pos  { return s.Rbrace.Shift("}") }
+func (s *DoStmt) End() Pos     { return s.Semicolon.Shift(";") }
+func (s *ReturnStmt) End() Pos { return s.Semicolon.Shift(";") }
+
+func (*LetStmt) stmtNode()    {}
+func (*IfStmt) stmtNode()     {}
+func (*WhileStmt) stmtNode()  {}
+func (*DoStmt) stmtNode()     {}
+func (*ReturnStmt) stmtNode() {}
+
+// BadExpr placeholder for a term that could not be parsed
+type BadExpr struct {
+	From Pos
+	To   Pos
+}
+
+// BinaryExpr term op term, the jack grammar has no precedence so chains are left associative
+type BinaryExpr struct {
+	X     Expr
+	OpPos Pos
+	Op    string
+	Y     Expr
+}
+
+// UnaryExpr unaryOp term
+type UnaryExpr struct {
+	OpPos Pos
+	Op    string
+	X     Expr
+}
+
+// ParenExpr '(' expression ')'
+type ParenExpr struct {
+	Lparen Pos
+	X      Expr
+	Rparen Pos
+}
+
+// IntLit integerConstant
+type IntLit struct {
+	ValuePos Pos
+	Value    string
+}
+
+// IntValue numeric value of the constant, zero if it doesn't fit an int
+func (e *IntLit) IntValue() int {
+	value, _ := strconv.Atoi(e.Value)
+	return value
+}
+
+// StringLit stringConstant
+type StringLit struct {
+	ValuePos Pos
+	Value    string
+}
+
+// KeywordLit keywordConstant (true, false, null, this)
+type KeywordLit struct {
+	ValuePos Pos
+	Value    string
+}
+
+// VarRef varName
+type VarRef struct {
+	Name *Ident
+}
+
+// IndexExpr varName '[' expression ']'
+type IndexExpr struct {
+	Name   *Ident
+	Index  Expr
+	Rbrack Pos
+}
+
+// CallExpr subroutineName '(' expressionList ')' | (className|varName) '.' subroutineName '(' expressionList ')'
+type CallExpr struct {
+	Receiver *Ident // nil when calling a subroutine of the current class
+	Name     *Ident
+	Args     []Expr
+	Rparen   Pos
+}
+
+func (e *BadExpr) Pos() Pos    { return e.From }
+func (e *BinaryExpr) Pos() Pos { return e.X.Pos() }
+func (e *UnaryExpr) Pos() Pos  { return e.OpPos }
+func (e *ParenExpr) Pos() Pos  { return e.Lparen }
+func (e *IntLit) Pos() Pos     { return e.ValuePos }
+func (e *StringLit) Pos() Pos  { return e.ValuePos }
+func (e *KeywordLit) Pos() Pos { return e.ValuePos }
+func (e *VarRef) Pos() Pos     { return e.Name.Pos() }
+func (e *IndexExpr) Pos() Pos  { return e.Name.Pos() }
+
+func (e *CallExpr) Pos() Pos {
+	if e.Receiver != nil {
+		return e.Receiver.Pos()
+	}
+	return e.Name.Pos()
+}
+
+func (e *BadExpr) End() Pos    { return e.To }
+func (e *BinaryExpr) End() Pos { return e.Y.End() }
+func (e *UnaryExpr) End() Pos  { return e.X.End() }
+func (e *ParenExpr) End() Pos  { return e.Rparen.Shift(")") }
+func (e *IntLit) End() Pos     { return e.ValuePos.Shift(e.Value) }
+func (e *StringLit) End() Pos  { return e.ValuePos.Shift(`"` + e.Value + `"`) }
+func (e *KeywordLit) End() Pos { return e.ValuePos.Shift(e.Value) }
+func (e *VarRef) End() Pos     { return e.Name.End() }
+func (e *IndexExpr) End() Pos  { return e.Rbrack.Shift("]") }
+func (e *CallExpr) End() Pos   { return e.Rparen.Shift(")") }
+
+func (*BadExpr) exprNode()    {}
+func (*BinaryExpr) exprNode() {}
+func (*UnaryExpr) exprNode()  {}
+func (*ParenExpr) exprNode()  {}
+func (*IntLit) exprNode()     {}
+func (*StringLit) exprNode()  {}
+func (*KeywordLit) exprNode() {}
+func (*VarRef) exprNode()     {}
+func (*IndexExpr) exprNode()  {}
+func (*CallExpr) exprNode()   {}
@@ -0,0 +1,83 @@
+package ast
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// Fprint writes the tree rooted at node, one field per line indented by depth, positions are
+// printed as line:col and nil fields are omitted
+func Fprint(w io.Writer, node Node) error {
+	p := &printer{w: w}
+	p.print(reflect.ValueOf(node), 0)
+	p.printf("\n")
+	return p.err
+}
+
+type printer struct {
+	w   io.Writer
+	err error
+}
+
+var posType = reflect.TypeFor[Pos]()
+
+func (p *printer) print(v reflect.Value, depth int) {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Pointer:
+		if v.IsNil() {
+			p.printf("nil")
+			return
+		}
+		if v.Kind() == reflect.Pointer {
+			p.printf("*")
+		}
+		p.print(v.Elem(), depth)
+	case reflect.Struct:
+		if v.Type() == posType {
+			p.printf("%s", v.Interface().(Pos))
+			return
+		}
+		p.printf("%s {", v.Type())
+		for i := range v.NumField() {
+			field := v.Field(i)
+			if isEmpty(field) {
+				continue
+			}
+			p.printf("\n%s%s: ", indent(depth+1), v.Type().Field(i).Name)
+			p.print(field, depth+1)
+		}
+		p.printf("\n%s}", indent(depth))
+	case reflect.Slice:
+		p.printf("%s (len = %d) {", v.Type(), v.Len())
+		for i := range v.Len() {
+			p.printf("\n%s%d: ", indent(depth+1), i)
+			p.print(v.Index(i), depth+1)
+		}
+		p.printf("\n%s}", indent(depth))
+	case reflect.String:
+		p.printf("%q", v.String())
+	default:
+		p.printf("%v", v.Interface())
+	}
+}
+
+// isEmpty nil pointers, interfaces and slices are left out of the output
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Pointer, reflect.Slice:
+		return v.IsNil()
+	}
+	return false
+}
+
+func indent(depth int) string {
+	return strings.Repeat(".  ", depth)
+}
+
+func (p *printer) printf(format string, args ...any) {
+	if p.err == nil {
+		_, p.err = fmt.Fprintf(p.w, format, args...)
+	}
+}
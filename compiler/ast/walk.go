@@ -0,0 +1,92 @@
+package ast
+
+// Inspect traverses the tree in depth-first order, calling f for every node; if f returns false
+// the children of that node are skipped
+func Inspect(node Node, f func(Node) bool) {
+	if node == nil || !f(node) {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Class:
+		Inspect(n.Name, f)
+		for _, dec := range n.Vars {
+			Inspect(dec, f)
+		}
+		for _, dec := range n.Subroutines {
+			Inspect(dec, f)
+		}
+	case *ClassVarDec:
+		Inspect(n.Type, f)
+		for _, name := range n.Names {
+			Inspect(name, f)
+		}
+	case *SubroutineDec:
+		Inspect(n.ReturnType, f)
+		Inspect(n.Name, f)
+		for _, param := range n.Params {
+			Inspect(param, f)
+		}
+		if n.Body != nil {
+			Inspect(n.Body, f)
+		}
+	case *Param:
+		Inspect(n.Type, f)
+		Inspect(n.Name, f)
+	case *SubroutineBody:
+		for _, dec := range n.Vars {
+			Inspect(dec, f)
+		}
+		inspectList(n.Statements, f)
+	case *VarDec:
+		Inspect(n.Type, f)
+		for _, name := range n.Names {
+			Inspect(name, f)
+		}
+	case *LetStmt:
+		Inspect(n.Name, f)
+		if n.Index != nil {
+			Inspect(n.Index, f)
+		}
+		Inspect(n.Value, f)
+	case *IfStmt:
+		Inspect(n.Cond, f)
+		inspectList(n.Then, f)
+		inspectList(n.Else, f)
+	case *WhileStmt:
+		Inspect(n.Cond, f)
+		inspectList(n.Body, f)
+	case *DoStmt:
+		Inspect(n.Call, f)
+	case *ReturnStmt:
+		if n.Value != nil {
+			Inspect(n.Value, f)
+		}
+	case *BinaryExpr:
+		Inspect(n.X, f)
+		Inspect(n.Y, f)
+	case *UnaryExpr:
+		Inspect(n.X, f)
+	case *ParenExpr:
+		Inspect(n.X, f)
+	case *VarRef:
+		Inspect(n.Name, f)
+	case *IndexExpr:
+		Inspect(n.Name, f)
+		Inspect(n.Index, f)
+	case *CallExpr:
+		if n.Receiver != nil {
+			Inspect(n.Receiver, f)
+		}
+		Inspect(n.Name, f)
+		for _, arg := range n.Args {
+			Inspect(arg, f)
+		}
+	}
+}
+
+func inspectList(stmts []Stmt, f func(Node) bool) {
+	for _, stmt := range stmts {
+		Inspect(stmt, f)
+	}
+}
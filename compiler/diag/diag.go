@@ -0,0 +1,166 @@
+// Package diag declares the diagnostics reported by the compiler and renders them with an
+// excerpt of the offending source, in the style of rustc:
+//
+//	syntax error: expected ';', got symbol '}'
+//	  --> Main.jack:5:14
+//	   |
+//	 5 |     let x = 1
+//	   |              ^
+//	   = help: did you forget a ';'?
+package diag
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/Dudssource/dd-jack-compiler/compiler/ast"
+)
+
+// Severity how bad a diagnostic is, only errors fail the compilation
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	}
+	return "unknown"
+}
+
+// Note secondary message attached to a diagnostic, usually pointing at a related declaration
+type Note struct {
+	File    string
+	Span    ast.Span
+	Message string
+}
+
+// Diagnostic message reported by one of the compiler phases
+type Diagnostic struct {
+	Severity Severity
+	Kind     string // phase reporting the error (lexical, syntax, compiler)
+	File     string
+	Span     ast.Span
+	Message  string
+	Help     string
+	Notes    []Note
+}
+
+// Errorf creates an error diagnostic
+func Errorf(kind string, span ast.Span, format string, args ...any) *Diagnostic {
+	return &Diagnostic{
+		Severity: Error,
+		Kind:     kind,
+		Span:     span,
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
+
+// Warnf creates a warning diagnostic
+func Warnf(span ast.Span, format string, args ...any) *Diagnostic {
+	return &Diagnostic{
+		Severity: Warning,
+		Span:     span,
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
+
+// WithHelp attaches a help message to the diagnostic
+func (d *Diagnostic) WithHelp(format string, args ...any) *Diagnostic {
+	d.Help = fmt.Sprintf(format, args...)
+	return d
+}
+
+// WithNote attaches a secondary message pointing at another place of the program
+func (d *Diagnostic) WithNote(file string, span ast.Span, format string, args ...any) *Diagnostic {
+	d.Notes = append(d.Notes, Note{File: file, Span: span, Message: fmt.Sprintf(format, args...)})
+	return d
+}
+
+// Title severity prefixed by the kind of error, e.g. syntax error
+func (d *Diagnostic) Title() string {
+	if d.Severity == Error && d.Kind != "" {
+		return d.Kind + " " + d.Severity.String()
+	}
+	return d.Severity.String()
+}
+
+// Error one line representation file:line:column: title: message
+func (d *Diagnostic) Error() string {
+	var sb strings.Builder
+	if d.File != "" {
+		sb.WriteString(d.File)
+		sb.WriteString(":")
+	}
+	if d.Span.Start.IsValid() {
+		sb.WriteString(d.Span.Start.String())
+		sb.WriteString(": ")
+	} else if d.File != "" {
+		sb.WriteString(" ")
+	}
+	sb.WriteString(d.Title())
+	sb.WriteString(": ")
+	sb.WriteString(d.Message)
+	return sb.String()
+}
+
+// List diagnostics reported while compiling
+type List []*Diagnostic
+
+func (l List) Error() string {
+	lines := make([]string, 0, len(l))
+	for _, d := range l {
+		lines = append(lines, d.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Count number of diagnostics with the given severity
+func (l List) Count(severity Severity) int {
+	cnt := 0
+	for _, d := range l {
+		if d.Severity == severity {
+			cnt++
+		}
+	}
+	return cnt
+}
+
+// Sort orders the diagnostics by their position in the file, the ones at the same position keep
+// the order they were reported in
+func (l List) Sort() {
+	slices.SortStableFunc(l, func(a, b *Diagnostic) int {
+		return cmp.Compare(a.Span.Start.Offset, b.Span.Start.Offset)
+	})
+}
+
+// SetFile sets the file of the diagnostics and notes reported without one (notes without a
+// position, e.g. pointing at the Jack OS API, are kept as they are)
+func (l List) SetFile(name string) {
+	for _, d := range l {
+		if d.File == "" {
+			d.File = name
+		}
+		for i := range d.Notes {
+			if d.Notes[i].File == "" && d.Notes[i].Span.Start.IsValid() {
+				d.Notes[i].File = name
+			}
+		}
+	}
+}
+
+// Err returns the list as an error when it contains at least one error, nil otherwise
+func (l List) Err() error {
+	if l.Count(Error) == 0 {
+		return nil
+	}
+	return l
+}
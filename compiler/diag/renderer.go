@@ -0,0 +1,136 @@
+package diag
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Dudssource/dd-jack-compiler/compiler/ast"
+)
+
+// Renderer prints diagnostics followed by the offending source line and a caret under the span
+type Renderer struct {
+	dst     io.Writer
+	sources map[string][]byte
+}
+
+func NewRenderer(dst io.Writer) *Renderer {
+	return &Renderer{
+		dst:     dst,
+		sources: make(map[string][]byte),
+	}
+}
+
+// AddSource registers the content of a file, files not registered are read from disk when needed
+func (r *Renderer) AddSource(name string, src []byte) {
+	r.sources[name] = src
+}
+
+// RenderAll renders every diagnostic of the list
+func (r *Renderer) RenderAll(diags List) {
+	for _, d := range diags {
+		r.Render(d)
+	}
+}
+
+// Render prints a single diagnostic
+func (r *Renderer) Render(d *Diagnostic) {
+	r.printf("%s: %s\n", d.Title(), d.Message)
+	gutter := r.gutterWidth(d)
+	r.excerpt(gutter, d.File, d.Span)
+	if d.Help != "" {
+		r.printf("%s = help: %s\n", strings.Repeat(" ", gutter), d.Help)
+	}
+	for _, note := range d.Notes {
+		r.printf("%s = note: %s\n", strings.Repeat(" ", gutter), note.Message)
+		r.excerpt(gutter, note.File, note.Span)
+	}
+	r.printf("\n")
+}
+
+// gutterWidth width of the line numbers column, shared by the excerpts of a diagnostic
+func (r *Renderer) gutterWidth(d *Diagnostic) int {
+	width := len(strconv.Itoa(d.Span.Start.Line))
+	for _, note := range d.Notes {
+		width = max(width, len(strconv.Itoa(note.Span.Start.Line)))
+	}
+	return width
+}
+
+// excerpt prints the location, the source line and the underline of the span
+func (r *Renderer) excerpt(gutter int, file string, span ast.Span) {
+	pad := strings.Repeat(" ", gutter)
+
+	if !span.Start.IsValid() {
+		if file != "" {
+			r.printf("%s--> %s\n", pad, file)
+		}
+		return
+	}
+
+	r.printf("%s--> %s:%s\n", pad, file, span.Start)
+
+	line, ok := r.line(file, span.Start.Line)
+	if !ok {
+		return
+	}
+
+	r.printf("%s |\n", pad)
+	r.printf("%*d | %s\n", gutter, span.Start.Line, line)
+	r.printf("%s | %s\n", pad, underline(line, span))
+}
+
+// line returns the text of the given line (one based) of the file
+func (r *Renderer) line(file string, lineNo int) (string, bool) {
+	src, ok := r.sources[file]
+	if !ok {
+		var err error
+		if src, err = os.ReadFile(file); err != nil {
+			return "", false
+		}
+		r.sources[file] = src
+	}
+
+	lines := bytes.Split(src, []byte("\n"))
+	if lineNo < 1 || lineNo > len(lines) {
+		return "", false
+	}
+	return strings.TrimRight(string(lines[lineNo-1]), "\r"), true
+}
+
+// underline carets under the span, tabs are kept so the carets line up with the source; spans
+// crossing lines are underlined up to the end of the first line
+func underline(line string, span ast.Span) string {
+	var sb strings.Builder
+
+	col := 1
+	for _, ch := range line {
+		if col >= span.Start.Column {
+			break
+		}
+		if ch == '\t' {
+			sb.WriteRune('\t')
+		} else {
+			sb.WriteRune(' ')
+		}
+		col++
+	}
+
+	width := 1
+	if span.End.Line == span.Start.Line && span.End.Column > span.Start.Column {
+		width = span.End.Column - span.Start.Column
+	} else if span.End.Line > span.Start.Line {
+		width = max(1, utf8.RuneCountInString(line)-span.Start.Column+1)
+	}
+	sb.WriteString(strings.Repeat("^", width))
+
+	return sb.String()
+}
+
+func (r *Renderer) printf(format string, args ...any) {
+	_, _ = fmt.Fprintf(r.dst, format, args...)
+}
@@ -0,0 +1,151 @@
+package diag
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Dudssource/dd-jack-compiler/compiler/ast"
+)
+
+// span of the given line, from column start to column end (exclusive)
+func span(line, start, end int) ast.Span {
+	return ast.Span{
+		Start: ast.Pos{Line: line, Column: start},
+		End:   ast.Pos{Line: line, Column: end},
+	}
+}
+
+func TestError(t *testing.T) {
+	tests := map[string]struct {
+		d    *Diagnostic
+		want string
+	}{
+		"error": {
+			d:    &Diagnostic{Severity: Error, Kind: "syntax", File: "Main.jack", Span: span(5, 14, 15), Message: "expected ';'"},
+			want: "Main.jack:5:14: syntax error: expected ';'",
+		},
+		"warning": {
+			d:    &Diagnostic{Severity: Warning, File: "Main.jack", Span: span(3, 17, 18), Message: "unused variable x"},
+			want: "Main.jack:3:17: warning: unused variable x",
+		},
+		"no position": {
+			d:    &Diagnostic{Severity: Error, Kind: "compiler", File: "Main.jack", Message: "no class"},
+			want: "Main.jack: compiler error: no class",
+		},
+		"no file": {
+			d:    Errorf("lexical", span(1, 2, 3), "illegal character"),
+			want: "1:2: lexical error: illegal character",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := test.d.Error(); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestListErr(t *testing.T) {
+	warnings := List{Warnf(span(1, 1, 2), "unused variable x")}
+	if err := warnings.Err(); err != nil {
+		t.Errorf("warnings only, got error %v", err)
+	}
+	errs := append(warnings, Errorf("syntax", span(2, 1, 2), "expected ';'"))
+	if errs.Err() == nil {
+		t.Error("no error returned for a list with an error")
+	}
+	if got := errs.Count(Warning); got != 1 {
+		t.Errorf("got %d warnings, want 1", got)
+	}
+}
+
+func TestSetFile(t *testing.T) {
+	l := List{
+		Errorf("compiler", span(1, 1, 2), "unknown class Foo").WithNote("", span(2, 1, 2), "declared here"),
+		Errorf("compiler", span(3, 1, 2), "arity").WithNote("", ast.Span{}, "Jack OS API"),
+		&Diagnostic{File: "Other.jack", Span: span(4, 1, 2)},
+	}
+	l.SetFile("Main.jack")
+	if l[0].File != "Main.jack" || l[0].Notes[0].File != "Main.jack" {
+		t.Errorf("file not set, got %q and note %q", l[0].File, l[0].Notes[0].File)
+	}
+	if l[1].Notes[0].File != "" {
+		t.Errorf("file set on a note without a position, got %q", l[1].Notes[0].File)
+	}
+	if l[2].File != "Other.jack" {
+		t.Errorf("file replaced, got %q", l[2].File)
+	}
+}
+
+func TestRender(t *testing.T) {
+	src := "class Main {\n    function void main() {\n        let x = 1\n\tlet y = 2;\n    }\n}\n"
+	tests := map[string]struct {
+		d    *Diagnostic
+		want string
+	}{
+		"caret and help": {
+			d: Errorf("syntax", span(3, 18, 18), "expected ';', got keyword 'let'").WithHelp("did you forget a ';'?"),
+			want: `syntax error: expected ';', got keyword 'let'
+ --> Main.jack:3:18
+  |
+3 |         let x = 1
+  |                  ^
+  = help: did you forget a ';'?
+
+`,
+		},
+		"underlined span": {
+			d: Warnf(span(3, 9, 12), "unreachable statement"),
+			want: `warning: unreachable statement
+ --> Main.jack:3:9
+  |
+3 |         let x = 1
+  |         ^^^
+
+`,
+		},
+		"tabs are kept": {
+			d:    Errorf("compiler", span(4, 6, 7), "unknown variable y"),
+			want: "compiler error: unknown variable y\n --> Main.jack:4:6\n  |\n4 | \tlet y = 2;\n  | \t    ^\n\n",
+		},
+		"span crossing lines": {
+			d: Errorf("compiler", ast.Span{Start: ast.Pos{Line: 2, Column: 5}, End: ast.Pos{Line: 5, Column: 6}}, "missing return"),
+			want: `compiler error: missing return
+ --> Main.jack:2:5
+  |
+2 |     function void main() {
+  |     ^^^^^^^^^^^^^^^^^^^^^^
+
+`,
+		},
+		"note": {
+			d: Errorf("compiler", span(4, 6, 7), "y is already declared").WithNote("Main.jack", span(12, 17, 18), "y is declared here"),
+			want: `compiler error: y is already declared
+  --> Main.jack:4:6
+   |
+ 4 | 	let y = 2;
+   | 	    ^
+   = note: y is declared here
+  --> Main.jack:12:17
+
+`,
+		},
+		"no position": {
+			d:    &Diagnostic{Severity: Error, Kind: "compiler", Message: "no class"},
+			want: "compiler error: no class\n --> Main.jack\n\n",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			test.d.File = "Main.jack"
+			var out strings.Builder
+			r := NewRenderer(&out)
+			r.AddSource("Main.jack", []byte(src))
+			r.Render(test.d)
+			if out.String() != test.want {
+				t.Errorf("got\n%s\nwant\n%s", out.String(), test.want)
+			}
+		})
+	}
+}
@@ -1,324 +1,260 @@
 package compiler
 
 import (
-	"errors"
 	"fmt"
 	"io"
-	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
-)
 
-var jackOSAPI = map[string]bool{
-	"Math":     true,
-	"String":   true,
-	"Array":    true,
-	"Output":   true,
-	"Screen":   true,
-	"Keyboard": true,
-	"Memory":   true,
-	"Sys":      true,
-}
+	"github.com/Dudssource/dd-jack-compiler/compiler/ast"
+	"github.com/Dudssource/dd-jack-compiler/compiler/diag"
+)
 
+// compilationEngine walks the syntax tree of a class emitting the VM code
 type compilationEngine struct {
-	tknzr          *jackTokenizer
-	builder        *strings.Builder
-	errorList      []error
-	symbolTable    *symbolTable
-	className      string
-	writer         *vmWriter
-	isDebugEnabled bool
-	labelsCounter  int
+	diagnostics     diag.List
+	index           *programIndex
+	symbolTable     *symbolTable
+	className       string
+	subroutine      *ast.SubroutineDec // subroutine being compiled
+	suppressed      map[int]bool       // lines of the declarations marked with a jack:unused comment
+	writer          *vmWriter
+	dropUnreachable bool // leave the unreachable statements out of the VM code
+	warnShadow      bool // warn about locals and parameters shadowing class variables
+	isDebugEnabled  bool
+	labelsCounter   int
 }
 
-func newCompilationEngine(tknzr *jackTokenizer, dstFile io.Writer) *compilationEngine {
+func newCompilationEngine(dstFile io.Writer, index *programIndex) *compilationEngine {
 	return &compilationEngine{
-		tknzr:          tknzr,
-		builder:        &strings.Builder{},
-		symbolTable:    newSymbolTable(),
-		writer:         &vmWriter{dstFile: dstFile},
-		isDebugEnabled: strings.EqualFold(os.Getenv("JACK_COMPILER_DEBUG"), "true"),
+		index:       index,
+		symbolTable: newSymbolTable(),
+		writer:      &vmWriter{dstFile: dstFile},
 	}
 }
 
-func (ce *compilationEngine) compile() error {
+func (ce *compilationEngine) compile(class *ast.Class) diag.List {
 
 	// compile class
-	ce.compileClass()
+	ce.compileClass(class)
 
-	return errors.Join(ce.errorList...)
+	return ce.diagnostics
 }
 
-func (ce *compilationEngine) compileClass() {
-	// start token
-	ce.tknzr.advance()
-
+func (ce *compilationEngine) compileClass(class *ast.Class) {
 	// <class>
-	ce.check("class")
 	{
 		// save class name
-		ce.className = ce.tokenValue()
-		ce.check("className")
-		ce.check("{")
-		{
-			// classVarDec*
-			for ce.tknzr.token().lex == Keyword {
-
-				var (
-					kind, name, ttype string
-				)
-
-				switch ce.tokenValue() {
-				case "static", "field":
-					// <classVarDec>
-
-					// kind
-					kind = ce.tokenValue()
-					ce.check(ce.tokenValue()) // static, field
-
-					// type
-					ttype = ce.tokenValue()
-					ce.check("type")
-
-					// varName
-					name = ce.tokenValue()
-					ce.check("varName")
-
-					// add to class symbol level (0)
-					ce.symbolTable.define(name, ttype, kind)
-
-					// (','varName)*
-					for ce.tokenValue() == "," {
-						ce.check(",")
-
-						// varName
-						name = ce.tokenValue()
-						ce.check("varName")
-
-						// add to class symbol level (0)
-						ce.symbolTable.define(name, ttype, kind)
-					}
-					ce.check(";")
-					// </classVarDec>
-					continue
-				}
-				break // for
-			}
-
-			if ce.isDebugEnabled {
-				ce.symbolTable.debug()
+		ce.className = class.Name.Name
+		ce.suppressed = suppressedLines(class.Comments)
+
+		// classVarDec*
+		for _, dec := range class.Vars {
+			// <classVarDec>
+			for _, name := range dec.Names {
+				// add to class symbol level (0)
+				ce.declare(name, dec.Type.Name, dec.Kind)
 			}
+			// </classVarDec>
+		}
 
-			// subroutineDec*
-			for ce.tknzr.token().lex == Keyword {
-				switch ce.tokenValue() {
-				case "constructor", "function", "method":
-
-					subroutineType := ce.tokenValue()
-
-					// <subroutineDec>
-
-					// next level
-					ce.symbolTable.next()
-
-					// "constructor", "function", "method"
-					if subroutineType == "method" {
-						ce.symbolTable.define("this", ce.className, "argument")
-					}
-					ce.check(ce.tokenValue())
-
-					if ce.tokenValue() == "void" {
-						ce.check("void")
-					} else {
-						ce.check("type")
-					}
-
-					subroutineName := fmt.Sprintf("%s.%s", ce.className, ce.tokenValue())
-					ce.check("subroutineName")
-					ce.check("(")
-					ce.compileParameterList()
-					ce.check(")")
-
-					ce.compileSubRoutineBody(subroutineName, subroutineType)
-
-					if ce.isDebugEnabled {
-						ce.symbolTable.debug()
-					}
-
-					// previous level
-					ce.symbolTable.prev()
+		if ce.isDebugEnabled {
+			ce.symbolTable.debug()
+		}
 
-					// </subroutineDec>
-					continue
-				}
-				break // for
+		// subroutineDec*
+		declared := make(map[string]*ast.SubroutineDec)
+		for _, dec := range class.Subroutines {
+			if prev, ok := declared[dec.Name.Name]; ok {
+				ce.report(diag.Errorf("compiler", ast.SpanOf(dec.Name), "subroutine %s.%s is already declared", ce.className, dec.Name.Name).
+					WithNote("", ast.SpanOf(prev.Name), "previous declaration of %s", dec.Name.Name))
+			} else {
+				declared[dec.Name.Name] = dec
 			}
+			ce.compileSubroutine(dec)
 		}
-		ce.check("}")
 
 		if ce.isDebugEnabled {
 			ce.symbolTable.debug()
 		}
+
+		// fields and statics are private to the class
+		for _, dec := range class.Vars {
+			for _, name := range dec.Names {
+				if item, ok := ce.declared(name); ok && item.reads+item.writes == 0 {
+					ce.warnUnused(name, fmt.Sprintf("unused %s %s", dec.Kind, name.Name))
+				}
+			}
+		}
 	}
 	// </class>
 }
 
-func (ce *compilationEngine) compileParameterList() {
-	// <parameterList>
-	{
-		if ce.tokenValue() != ")" {
+func (ce *compilationEngine) compileSubroutine(dec *ast.SubroutineDec) {
+	// <subroutineDec>
 
-			var (
-				name, ttype string
-			)
+	// next level
+	ce.symbolTable.next()
+	ce.subroutine = dec
 
-			// type
-			ttype = ce.tokenValue()
-			ce.check("type")
+	// "constructor", "function", "method"
+	if dec.Kind == "method" {
+		ce.symbolTable.define("this", ce.className, "argument")
+	}
 
-			// varName
-			name = ce.tokenValue()
-			ce.check("varName")
+	subroutineName := fmt.Sprintf("%s.%s", ce.className, dec.Name.Name)
+	ce.compileParameterList(dec.Params)
 
-			// add to symbol table
-			ce.symbolTable.define(name, ttype, "argument")
+	ce.compileSubRoutineBody(subroutineName, dec.Kind, dec.Body)
 
-			for ce.tokenValue() == "," {
-				ce.check(",")
+	if ce.isDebugEnabled {
+		ce.symbolTable.debug()
+	}
 
-				// type
-				ttype = ce.tokenValue()
-				ce.check("type")
+	ce.checkUnused(dec)
+	ce.diagnostics = append(ce.diagnostics, checkAssignments(dec)...)
 
-				// varName
-				name = ce.tokenValue()
-				ce.check("varName")
+	// previous level
+	ce.symbolTable.prev()
 
-				// add to symbol table
-				ce.symbolTable.define(name, ttype, "argument")
-			}
-		}
+	// </subroutineDec>
+}
+
+func (ce *compilationEngine) compileParameterList(params []*ast.Param) {
+	// <parameterList>
+	for _, param := range params {
+		// add to symbol table
+		ce.declare(param.Name, param.Type.Name, "argument")
 	}
 	// </parameterList>
 }
 
-func (ce *compilationEngine) compileSubRoutineBody(subroutineName, subroutineType string) {
+func (ce *compilationEngine) compileSubRoutineBody(subroutineName, subroutineType string, body *ast.SubroutineBody) {
 	// <subroutineBody>
 	{
-		ce.check("{")
-		{
-			for ce.tokenValue() == "var" {
-
-				var (
-					name, ttype string
-				)
-
-				// <varDec>
-				ce.check("var")
-
-				// type
-				ttype = ce.tokenValue()
-				ce.check("type")
-
-				// varName
-				name = ce.tokenValue()
-				ce.check("varName")
-
+		for _, dec := range body.Vars {
+			// <varDec>
+			for _, name := range dec.Names {
 				// add to symbol table
-				ce.symbolTable.define(name, ttype, "local")
-
-				for ce.tokenValue() == "," {
-					ce.check(",")
-
-					// varName
-					name = ce.tokenValue()
-					ce.check("varName")
-
-					// add to symbol table
-					ce.symbolTable.define(name, ttype, "local")
-				}
-
-				ce.check(";")
-				// </varDec>
+				ce.declare(name, dec.Type.Name, "local")
 			}
+			// </varDec>
+		}
 
-			// write function
-			switch subroutineType {
-			case "function":
-				ce.writer.writeFunction(subroutineName, ce.symbolTable.varCount("local"))
-			case "method":
-				ce.writer.writeFunction(subroutineName, ce.symbolTable.varCount("local"))
-				ce.writer.writePush("argument", 0)
-				ce.writer.writePop("pointer", 0)
-			case "constructor":
-				ce.writer.writeFunction(subroutineName, 0)
-				ce.writer.writePush("constant", ce.symbolTable.varCount("this"))
-				ce.writer.writeCall("Memory.alloc", 1)
-				ce.writer.writePop("pointer", 0)
-			}
+		// write function
+		switch subroutineType {
+		case "function":
+			ce.writer.writeFunction(subroutineName, ce.symbolTable.varCount("local"))
+		case "method":
+			ce.writer.writeFunction(subroutineName, ce.symbolTable.varCount("local"))
+			ce.writer.writePush("argument", 0)
+			ce.writer.writePop("pointer", 0)
+		case "constructor":
+			ce.writer.writeFunction(subroutineName, 0)
+			ce.writer.writePush("constant", ce.symbolTable.varCount("this"))
+			ce.writer.writeCall("Memory.alloc", 1)
+			ce.writer.writePop("pointer", 0)
+		}
 
-			ce.compileStatements()
+		if !ce.compileStatements(body.Statements) {
+			ce.missingReturn(body)
 		}
-		ce.check("}")
 	}
 	// </subroutineBody>
 }
 
-func (ce *compilationEngine) compileStatements() {
+// compileStatements returns true when every path through the statements ends in a return, the
+// statements following such a path are unreachable
+func (ce *compilationEngine) compileStatements(stmts []ast.Stmt) bool {
+	returns := false
 	// <statements>
-	{
-		for ce.tknzr.hasMoreTokens() {
-			switch ce.tokenValue() {
-			case "while":
-				ce.compileWhile()
-				continue // for
-			case "let":
-				ce.compileLet()
-				continue // for
-			case "if":
-				ce.compileIf()
-				continue // for
-			case "do":
-				ce.compileDo()
-				continue // for
-			case "return":
-				ce.compileReturn()
-				continue // for
+	for i, stmt := range stmts {
+		if returns {
+			warned := ce.unreachable(stmts[i-1], stmts[i:])
+			writer := ce.writer
+			if ce.dropUnreachable && warned {
+				// still compiled for their diagnostics
+				ce.writer = &vmWriter{dstFile: io.Discard}
+			}
+			for _, stmt := range stmts[i:] {
+				ce.compileStatement(stmt)
 			}
-			break // for
+			ce.writer = writer
+			break
 		}
+		returns = ce.compileStatement(stmt)
 	}
 	// </statements>
+	return returns
+}
+
+// compileStatement returns true when every path through the statement ends in a return
+func (ce *compilationEngine) compileStatement(stmt ast.Stmt) bool {
+	switch s := stmt.(type) {
+	case *ast.WhileStmt:
+		return ce.compileWhile(s)
+	case *ast.LetStmt:
+		ce.compileLet(s)
+	case *ast.IfStmt:
+		return ce.compileIf(s)
+	case *ast.DoStmt:
+		ce.compileDo(s)
+	case *ast.ReturnStmt:
+		ce.compileReturn(s)
+		return true
+	}
+	return false
+}
+
+// unreachable warns about the statements following a statement that always returns, except for the
+// return closing a subroutine after an endless loop (every subroutine ends with a return), returning
+// false when no warning was reported so the statements are kept
+func (ce *compilationEngine) unreachable(last ast.Stmt, stmts []ast.Stmt) bool {
+	if _, ok := last.(*ast.WhileStmt); ok && len(stmts) == 1 {
+		if _, ok := stmts[0].(*ast.ReturnStmt); ok {
+			return false
+		}
+	}
+
+	message := "unreachable statement"
+	if len(stmts) > 1 {
+		message += "s"
+	}
+	d := diag.Warnf(ast.Span{Start: stmts[0].Pos(), End: stmts[len(stmts)-1].End()}, "%s", message)
+	switch last.(type) {
+	case *ast.ReturnStmt:
+		d.WithNote("", ast.SpanOf(last), "any code following this return is never executed")
+	case *ast.IfStmt:
+		d.WithNote("", ast.SpanOf(last), "both branches of this if return")
+	case *ast.WhileStmt:
+		d.WithNote("", ast.SpanOf(last), "this loop can only be left through a return")
+	}
+	ce.report(d)
+	return true
 }
 
-func (ce *compilationEngine) compileLet() {
+func (ce *compilationEngine) compileLet(stmt *ast.LetStmt) {
 	// <letStatement>
 	{
-		var isArray bool
-		ce.check("let")
-		varName := ce.tknzr.token()
-		ce.check("varName")
-
-		varTbl, ok := ce.symbolTable.find(varName.value)
-		if !ok {
-			ce.undeclared(varName)
+		varTbl, _ := ce.lookup(stmt.Name)
+		if stmt.Index == nil {
+			ce.symbolTable.markWrite(stmt.Name.Name)
+		} else {
+			// the array is read, not assigned
+			ce.symbolTable.markRead(stmt.Name.Name)
 		}
 
-		if ce.tokenValue() == "[" {
-			isArray = true
-			ce.check("[")
-			ce.compileExpression()
-			ce.check("]")
+		if stmt.Index != nil {
+			ce.compileExpression(stmt.Index)
 			// push
 			ce.writer.writePush(varTbl.kind, varTbl.position)
 			// add
 			ce.writer.writeOp("+")
 		}
-		ce.check("=")
-		ce.compileExpression()
-		ce.check(";")
+		ce.compileExpression(stmt.Value)
 
-		if !isArray {
+		if stmt.Index == nil {
 			// pop
 			ce.writer.writePop(varTbl.kind, varTbl.position)
 		} else {
@@ -331,17 +267,17 @@ func (ce *compilationEngine) compileLet() {
 	// </letStatement>
 }
 
-func (ce *compilationEngine) compileReturn() {
+func (ce *compilationEngine) compileReturn(stmt *ast.ReturnStmt) {
+	ce.checkReturn(stmt)
+
 	// <returnStatement>
-	ce.check("return")
 	// expression?
-	if ce.tokenValue() != ";" {
-		ce.compileExpression()
+	if stmt.Value != nil {
+		ce.compileExpression(stmt.Value)
 	} else {
 		// no return variable
 		ce.writer.writePush("constant", 0)
 	}
-	ce.check(";")
 	// return
 	ce.writer.writeReturn()
 	// </returnStatement>
@@ -353,51 +289,43 @@ func (ce *compilationEngine) label() string {
 	return fmt.Sprintf("%s_%s", ce.className, value)
 }
 
-func (ce *compilationEngine) compileIf() {
+// compileIf returns true when both branches return
+func (ce *compilationEngine) compileIf(stmt *ast.IfStmt) bool {
 
 	var (
 		labelB = ce.label()
 		labelA = ce.label()
+		// every path of the branch returns
+		thenReturns, elseReturns bool
 	)
 
 	// <ifStatement>
 	{
-		ce.check("if")
-		ce.check("(")
-		{
-			ce.compileExpression()
-			// not
-			ce.writer.writeUnaryOp("~")
-			// if-goto label A
-			ce.writer.writeIf(labelA)
-		}
-		ce.check(")")
-		ce.check("{")
-		{
-			ce.compileStatements()
-			ce.writer.writeGoto(labelB)
-		}
-		ce.check("}")
+		ce.compileExpression(stmt.Cond)
+		// not
+		ce.writer.writeUnaryOp("~")
+		// if-goto label A
+		ce.writer.writeIf(labelA)
+
+		thenReturns = ce.compileStatements(stmt.Then)
+		ce.writer.writeGoto(labelB)
 	}
 	// label A
 	ce.writer.writeLabel(labelA)
 	{
 		// ('else''{statements'}')?
-		if ce.tokenValue() == "else" {
-			ce.check("else")
-			ce.check("{")
-			{
-				ce.compileStatements()
-			}
-			ce.check("}")
-		}
+		elseReturns = ce.compileStatements(stmt.Else)
 	}
 	// goto label B
 	ce.writer.writeLabel(labelB)
 	// </ifStatement>
+
+	return thenReturns && elseReturns
 }
 
-func (ce *compilationEngine) compileWhile() {
+// compileWhile returns true when the loop never ends (while (true), Jack has no break) so the
+// statements after it can only be reached through a return
+func (ce *compilationEngine) compileWhile(stmt *ast.WhileStmt) bool {
 
 	var (
 		labelA = ce.label()
@@ -409,285 +337,460 @@ func (ce *compilationEngine) compileWhile() {
 		// label A
 		ce.writer.writeLabel(labelA)
 
-		ce.check("while")
-		ce.check("(")
-		{
-			ce.compileExpression()
-			// not
-			ce.writer.writeUnaryOp("~")
-			// if-goto LB
-			ce.writer.writeIf(labelB)
-		}
-		ce.check(")")
-		ce.check("{")
-		{
-			ce.compileStatements()
-			// goto LA
-			ce.writer.writeGoto(labelA)
-		}
-		ce.check("}")
+		ce.compileExpression(stmt.Cond)
+		// not
+		ce.writer.writeUnaryOp("~")
+		// if-goto LB
+		ce.writer.writeIf(labelB)
+
+		ce.compileStatements(stmt.Body)
+		// goto LA
+		ce.writer.writeGoto(labelA)
 
 		// label B
 		ce.writer.writeLabel(labelB)
-
 	}
 	// </whileStatement>
+
+	return isTrue(stmt.Cond)
 }
 
-func (ce *compilationEngine) compileDo() {
+func (ce *compilationEngine) compileDo(stmt *ast.DoStmt) {
 	// <doStatement>
 	{
-		ce.check("do")
 		// subroutineCall
-		{
-			// term (without tag)
-			ce.compileTerm()
-
-			// optional (op term)*
-			for ce.tknzr.token().lex == Symbol {
-				switch ce.tokenValue() {
-				// op
-				case "+", "-", "=", ">", "<", "*", "/", "&", "|":
-					//ce.printXML(ce.tknzr.token())
-					ce.tknzr.advance()
-					ce.compileTerm()
-					continue
-				}
-				break // for
-			}
-		}
+		ce.compileCall(stmt.Call)
 
 		// ignore returned value
 		ce.writer.writePop("temp", 0)
-
-		ce.check(";")
 	}
 	// </doStatement>
 }
 
-func (ce *compilationEngine) compileExpression() {
+func (ce *compilationEngine) compileExpression(expr ast.Expr) {
 	// <expression>
-	{
+	switch e := expr.(type) {
+	case *ast.BinaryExpr:
+		// term (op term)*
+		ce.compileExpression(e.X)
+		ce.compileExpression(e.Y)
+		ce.writer.writeOp(e.Op)
+	default:
 		// term
-		ce.compileTerm()
-
-		// optional (op term)*
-		for ce.tknzr.token().lex == Symbol {
-			switch ce.tokenValue() {
-			// op
-			case "+", "-", "=", ">", "<", "*", "/", "&", "|":
-				op := ce.tokenValue()
-				ce.tknzr.advance()
-				ce.compileTerm()
-				ce.writer.writeOp(op)
-				continue
-			}
-			break // for
-		}
+		ce.compileTerm(expr)
 	}
-
 	// </expression>
 }
 
-func (ce *compilationEngine) compileTerm() {
+func (ce *compilationEngine) compileTerm(expr ast.Expr) {
 
 	// <term>
-	{
-		switch ce.tknzr.token().lex {
-		case Identifier:
-			// save varName
-			identifier := ce.tknzr.token()
-			ce.check("identifier") // varName, className, subroutineName
-			switch ce.tokenValue() {
-			case "[":
-				ce.check("[")
-				ce.compileExpression()
-				ce.check("]")
-				// push var
-				if varTbl, ok := ce.symbolTable.find(identifier.value); ok {
-					ce.writer.writePush(varTbl.kind, varTbl.position)
-				} else {
-					ce.undeclared(identifier)
-				}
-				// add
-				ce.writer.writeOp("+")
-				// src
-				ce.writer.writePop("pointer", 1)
-				ce.writer.writePush("that", 0)
-			case "(":
-
-				// method refers to this
-				ce.writer.writePush("pointer", 0)
-				target := ce.className
-				methodName := fmt.Sprintf("%s.%s", target, identifier.value)
-				ce.check("(")
-				expN := ce.compileExpressionList()
-				ce.check(")")
-
-				// call f n
-				ce.writer.writeCall(methodName, expN+1)
-			case ".":
-				ce.check(".")
-				padding := 0
-				target := identifier.value
-				// push var
-				if objectTbl, ok := ce.symbolTable.find(identifier.value); ok {
-					padding = 1
-					target = objectTbl.ttype
-					ce.writer.writePush(objectTbl.kind, objectTbl.position)
-				} else if !jackOSAPI[target] && target != ce.className {
-					//ce.undeclared(identifier)
-					//TODO
-				}
-				subroutineName := fmt.Sprintf("%s.%s", target, ce.tokenValue())
-				ce.check("subroutineName")
-				ce.check("(")
-				expN := ce.compileExpressionList()
-				ce.check(")")
-				// call f n
-				ce.writer.writeCall(subroutineName, expN+padding)
-			default:
-				// push var
-				if varTbl, ok := ce.symbolTable.find(identifier.value); ok {
-					ce.writer.writePush(varTbl.kind, varTbl.position)
-				} else {
-					ce.undeclared(identifier)
-				}
-			}
-		case IntConst:
-			val, _ := strconv.Atoi(ce.tokenValue())
-			ce.writer.writePush("constant", val)
-			ce.check("constant")
-		case StringConst:
-			// string value
-			str := ce.tokenValue()
-			ce.check("constant")
-			ce.writer.writePush("constant", len(str))
-			ce.writer.writeCall("String.new", 1)
-			for _, c := range str {
-				ce.writer.writePush("constant", int(c))
-				ce.writer.writeCall("String.appendChar", 2)
-			}
-		case Keyword: // keyword constant
-			switch ce.tokenValue() {
-			case "true":
-				ce.check(ce.tokenValue())
-				// true
-				ce.writer.writePush("constant", 1)
-				// neg
-				ce.writer.writeUnaryOp("-")
-			case "false":
-				ce.check(ce.tokenValue())
-				// false
-				ce.writer.writePush("constant", 0)
-			case "null":
-				ce.check(ce.tokenValue())
-				// zero
-				ce.writer.writePush("constant", 0)
-			case "this":
-				ce.check(ce.tokenValue())
-				// constructor return
-				ce.writer.writePush("pointer", 0)
-			default:
-				ce.expected("keywordConstant")
-			}
-		case Symbol:
-
-			// (expression)
-			if ce.tokenValue() == "(" {
-				ce.check("(")
-				ce.compileExpression()
-				ce.check(")")
-
-				// unaryOp
-			} else if ce.tokenValue() == "-" || ce.tokenValue() == "~" {
-				// unary op
-				unaryOp := ce.tokenValue()
-				ce.check(ce.tokenValue()) // unaryOp - ~
-				ce.compileTerm()
-				// unary op
-				ce.writer.writeUnaryOp(unaryOp)
-			} else {
-				ce.expected("parenthesis or unaryOp")
+	switch e := expr.(type) {
+	case *ast.VarRef:
+		// push var
+		if varTbl, ok := ce.lookup(e.Name); ok {
+			ce.symbolTable.markRead(e.Name.Name)
+			ce.writer.writePush(varTbl.kind, varTbl.position)
+		}
+	case *ast.IndexExpr:
+		ce.compileExpression(e.Index)
+		// push var
+		if varTbl, ok := ce.lookup(e.Name); ok {
+			ce.symbolTable.markRead(e.Name.Name)
+			ce.writer.writePush(varTbl.kind, varTbl.position)
+		}
+		// add
+		ce.writer.writeOp("+")
+		// src
+		ce.writer.writePop("pointer", 1)
+		ce.writer.writePush("that", 0)
+	case *ast.CallExpr:
+		ce.compileCall(e)
+	case *ast.IntLit:
+		ce.writer.writePush("constant", e.IntValue())
+	case *ast.StringLit:
+		// string value
+		ce.writer.writePush("constant", len(e.Value))
+		ce.writer.writeCall("String.new", 1)
+		for _, c := range e.Value {
+			ce.writer.writePush("constant", int(c))
+			ce.writer.writeCall("String.appendChar", 2)
+		}
+	case *ast.KeywordLit: // keyword constant
+		switch e.Value {
+		case "true":
+			// true
+			ce.writer.writePush("constant", 1)
+			// neg
+			ce.writer.writeUnaryOp("-")
+		case "false":
+			// false
+			ce.writer.writePush("constant", 0)
+		case "null":
+			// zero
+			ce.writer.writePush("constant", 0)
+		case "this":
+			if ce.subroutine.Kind == "function" {
+				ce.report(ce.inFunction(diag.Errorf("compiler", ast.SpanOf(e), "cannot use this in a function").
+					WithHelp("functions have no this, declare %s as a method", ce.subroutine.Name.Name)))
 			}
-		default:
-			ce.expected("varName or constant")
+			// constructor return
+			ce.writer.writePush("pointer", 0)
+		}
+	case *ast.ParenExpr:
+		// (expression)
+		ce.compileExpression(e.X)
+	case *ast.UnaryExpr:
+		if lit, ok := e.X.(*ast.IntLit); ok && e.Op == "-" && lit.IntValue() == maxIntConst+1 {
+			// -32768 can't be pushed as a constant, fold it to ~32767
+			ce.writer.writePush("constant", maxIntConst)
+			ce.writer.writeUnaryOp("~")
+			break
 		}
+		ce.compileTerm(e.X)
+		// unary op
+		ce.writer.writeUnaryOp(e.Op)
 	}
 
 	// </term>
 }
 
-func (ce *compilationEngine) compileExpressionList() int {
-	// <expressionList>
-	cnt := 0
-	{
-		// handle empty expression list
-		if ce.tokenValue() != ")" {
-			cnt++
-			ce.compileExpression()
-			// (, expression)*
-			for ce.tokenValue() == "," {
-				ce.check(",")
-				cnt++
-				ce.compileExpression()
-			}
+func (ce *compilationEngine) compileCall(call *ast.CallExpr) {
+
+	// subroutineName '(' expressionList ')'
+	if call.Receiver == nil {
+
+		sub := ce.resolve(ce.className, call.Name, nil)
+		ce.checkArity(call, sub)
+		ce.checkCallKind(call, sub, false)
+
+		// method refers to this
+		ce.writer.writePush("pointer", 0)
+		methodName := fmt.Sprintf("%s.%s", ce.className, call.Name.Name)
+		expN := ce.compileExpressionList(call.Args)
+
+		// call f n
+		ce.writer.writeCall(methodName, expN+1)
+		return
+	}
+
+	// (className|varName) '.' subroutineName '(' expressionList ')'
+	padding := 0
+	target := call.Receiver.Name
+	// push var
+	if objectTbl, ok := ce.symbolTable.find(call.Receiver.Name); ok {
+		ce.checkFieldAccess(call.Receiver, objectTbl)
+		ce.symbolTable.markRead(call.Receiver.Name)
+		padding = 1
+		target = objectTbl.ttype
+		ce.writer.writePush(objectTbl.kind, objectTbl.position)
+		var sub *subroutineInfo
+		if isPrimitiveType(target) {
+			ce.report(diag.Errorf("compiler", ast.SpanOf(call.Receiver), "cannot call %s on %s (variable of type %s)",
+				call.Name.Name, call.Receiver.Name, target).
+				WithNote("", objectTbl.span, "%s is declared with type %s", call.Receiver.Name, target).
+				WithHelp("subroutines can only be called on objects"))
+		} else {
+			sub = ce.resolve(target, call.Name, call.Receiver)
 		}
+		ce.checkArity(call, sub)
+		ce.checkCallKind(call, sub, true)
+	} else {
+		sub := ce.resolve(target, call.Name, call.Receiver)
+		ce.checkArity(call, sub)
+		ce.checkCallKind(call, sub, false)
 	}
-	return cnt
+	subroutineName := fmt.Sprintf("%s.%s", target, call.Name.Name)
+	expN := ce.compileExpressionList(call.Args)
+	// call f n
+	ce.writer.writeCall(subroutineName, expN+padding)
+}
+
+func (ce *compilationEngine) compileExpressionList(args []ast.Expr) int {
+	// <expressionList>
+	for _, arg := range args {
+		ce.compileExpression(arg)
+	}
+	return len(args)
 	// </expressionList>
 }
 
-func (ce *compilationEngine) expected(expected any) {
-	err := fmt.Errorf("syntax error : expected %v, got %s", expected, ce.tknzr.token().String())
-	ce.errorList = append(ce.errorList, err)
+// resolve looks up the subroutine called, reporting unknown classes (only when the call has a
+// receiver, a class or a variable of that class, and every class of the program is known) and
+// unknown subroutines of known classes
+func (ce *compilationEngine) resolve(className string, name, receiver *ast.Ident) *subroutineInfo {
+	cls, ok := ce.index.classes[className]
+	if !ok {
+		if receiver == nil || !ce.index.closed {
+			return nil
+		}
+		d := diag.Errorf("compiler", ast.SpanOf(receiver), "unknown class %s", className)
+		if item, ok := ce.symbolTable.find(receiver.Name); ok {
+			d.WithNote("", item.span, "%s is declared with type %s", receiver.Name, className).
+				WithHelp("no file of the program declares class %s", className)
+		} else {
+			d.WithHelp("no file of the program declares class %s, nor is it a variable in scope", className)
+		}
+		ce.report(d)
+		return nil
+	}
+
+	if cls.functions != nil {
+		// compiled class, its signatures are unknown
+		if !cls.functions[name.Name] {
+			ce.report(diag.Errorf("compiler", ast.SpanOf(name), "unknown subroutine %s.%s", className, name.Name).
+				WithNote(cls.fileName, ast.Span{}, "class %s is compiled in %s", className, filepath.Base(cls.fileName)))
+		}
+		return nil
+	}
+
+	sub, ok := cls.subroutines[name.Name]
+	if !ok {
+		d := diag.Errorf("compiler", ast.SpanOf(name), "unknown subroutine %s.%s", className, name.Name)
+		if cls.builtin {
+			d.WithNote("", ast.Span{}, "class %s is part of the Jack OS API (%s)", className, JackOSAPIVersion)
+		} else {
+			d.WithNote(cls.fileName, cls.span, "class %s is declared here", className)
+		}
+		ce.report(d)
+		return nil
+	}
+	return sub
+}
+
+// checkArity compares the number of arguments of a call with the parameters declared by the
+// subroutine (nil when it couldn't be resolved)
+func (ce *compilationEngine) checkArity(call *ast.CallExpr, sub *subroutineInfo) {
+	if sub == nil || len(call.Args) == len(sub.params) {
+		return
+	}
+	ce.report(ce.declaredHere(diag.Errorf("compiler", ast.SpanOf(call), "%s %s.%s expects %s, got %d",
+		sub.kind, sub.className, sub.name, plural(len(sub.params), "argument"), len(call.Args)), sub))
+}
+
+// checkCallKind reports calls that don't match the kind of the subroutine: methods need an object
+// (this, when called without a receiver) while functions and constructors are called on their class
+func (ce *compilationEngine) checkCallKind(call *ast.CallExpr, sub *subroutineInfo, onObject bool) {
+	if sub == nil {
+		return
+	}
+
+	qualified := fmt.Sprintf("%s.%s", sub.className, sub.name)
+
+	if sub.kind == "method" {
+		switch {
+		case call.Receiver == nil && ce.subroutine.Kind == "function":
+			ce.report(ce.inFunction(diag.Errorf("compiler", ast.SpanOf(call.Name), "cannot call method %s without an object", qualified).
+				WithHelp("functions have no this, call the method on a variable of type %s", sub.className)))
+		case call.Receiver != nil && !onObject:
+			ce.report(ce.declaredHere(diag.Errorf("compiler", ast.SpanOf(call), "cannot call method %s on class %s", qualified, sub.className).
+				WithHelp("methods need an object, call it on a variable of type %s", sub.className), sub))
+		}
+		return
+	}
+
+	// functions and constructors
+	switch {
+	case call.Receiver == nil && sub.kind == "constructor":
+		ce.report(ce.declaredHere(diag.Errorf("compiler", ast.SpanOf(call.Name), "cannot call constructor %s through this", qualified).
+			WithHelp("call it on the class: %s(...)", qualified), sub))
+	case call.Receiver == nil:
+		ce.report(ce.declaredHere(diag.Errorf("compiler", ast.SpanOf(call.Name), "cannot call function %s without its class name", qualified).
+			WithHelp("call it on the class: %s(...)", qualified), sub))
+	case onObject:
+		ce.report(ce.declaredHere(diag.Errorf("compiler", ast.SpanOf(call), "cannot call %s %s through an instance", sub.kind, qualified).
+			WithHelp("call it on the class: %s(...)", qualified), sub))
+	}
+}
+
+// declaredHere attaches a note pointing at the declaration of the subroutine
+func (ce *compilationEngine) declaredHere(d *diag.Diagnostic, sub *subroutineInfo) *diag.Diagnostic {
+	if sub.fileName == "" {
+		return d.WithNote("", ast.Span{}, "%s.%s is part of the Jack OS API as %s", sub.className, sub.name, sub.signature())
+	}
+	return d.WithNote(sub.fileName, sub.span, "%s.%s is declared here", sub.className, sub.name)
 }
 
-func (ce *compilationEngine) undeclared(tkn *Token) {
-	err := fmt.Errorf("compiler error : undeclared var %s", tkn.String())
-	ce.errorList = append(ce.errorList, err)
+// plural formats a count followed by the noun, e.g. 1 argument, 2 arguments
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
 }
 
-func (ce *compilationEngine) tokenValue() string {
-	return ce.tknzr.token().value
+func (ce *compilationEngine) report(d *diag.Diagnostic) {
+	ce.diagnostics = append(ce.diagnostics, d)
 }
 
-func (ce *compilationEngine) check(expected string) {
-	switch expected {
-	case "varName", "className", "subroutineName", "identifier":
-		if ce.tknzr.token().lex != Identifier {
-			ce.expected(expected)
+// checkReturn compares the returned value with the declaration of the subroutine
+func (ce *compilationEngine) checkReturn(stmt *ast.ReturnStmt) {
+	dec := ce.subroutine
+	qualified := fmt.Sprintf("%s.%s", ce.className, dec.Name.Name)
+
+	switch {
+	case dec.ReturnType.Name == "void" && stmt.Value != nil:
+		ce.report(ce.returnsHere(diag.Errorf("compiler", ast.SpanOf(stmt.Value), "void subroutine %s cannot return a value", qualified).
+			WithHelp("use 'return;' or declare the return type of %s", dec.Name.Name)))
+	case dec.ReturnType.Name != "void" && stmt.Value == nil:
+		ce.report(ce.returnsHere(diag.Errorf("compiler", ast.SpanOf(stmt), "missing return value, %s returns %s", qualified, dec.ReturnType.Name)))
+	case dec.Kind == "constructor" && stmt.Value != nil:
+		if lit, ok := stmt.Value.(*ast.KeywordLit); !ok || lit.Value != "this" {
+			ce.report(diag.Warnf(ast.SpanOf(stmt.Value), "constructor %s should return this", qualified).
+				WithHelp("the caller receives the returned value as the new object"))
 		}
-	case "constant":
-		if ce.tknzr.token().lex != StringConst && ce.tknzr.token().lex != IntConst {
-			ce.expected(expected)
+	}
+}
+
+// missingReturn reports a subroutine whose last statement can be reached without returning, the
+// VM code would fall through into the next function
+func (ce *compilationEngine) missingReturn(body *ast.SubroutineBody) {
+	dec := ce.subroutine
+	d := diag.Errorf("compiler", ast.Span{Start: body.Rbrace, End: body.Rbrace.Shift("}")},
+		"missing return at the end of %s.%s", ce.className, dec.Name.Name)
+	switch {
+	case dec.Kind == "constructor":
+		d.WithHelp("add 'return this;'")
+	case dec.ReturnType.Name == "void":
+		d.WithHelp("add 'return;', every subroutine must end with a return")
+	default:
+		d.WithHelp("every path must end with 'return' followed by a value")
+		ce.returnsHere(d)
+	}
+	ce.report(d)
+}
+
+// returnsHere attaches a note pointing at the return type of the subroutine being compiled
+func (ce *compilationEngine) returnsHere(d *diag.Diagnostic) *diag.Diagnostic {
+	dec := ce.subroutine
+	return d.WithNote("", ast.SpanOf(dec.ReturnType), "%s.%s is declared as returning %s", ce.className, dec.Name.Name, dec.ReturnType.Name)
+}
+
+// isTrue reports whether the expression is the constant true, possibly parenthesized
+func isTrue(expr ast.Expr) bool {
+	for {
+		paren, ok := expr.(*ast.ParenExpr)
+		if !ok {
+			break
 		}
-	case "constructor", "function", "method":
-		if ce.tknzr.token().lex != Keyword {
-			ce.expected(expected)
+		expr = paren.X
+	}
+	lit, ok := expr.(*ast.KeywordLit)
+	return ok && lit.Value == "true"
+}
+
+// checkUnused warns about the parameters and locals of the subroutine never read
+func (ce *compilationEngine) checkUnused(dec *ast.SubroutineDec) {
+	for _, param := range dec.Params {
+		if item, ok := ce.declared(param.Name); ok && item.reads == 0 {
+			if item.writes == 0 {
+				ce.warnUnused(param.Name, fmt.Sprintf("unused parameter %s", param.Name.Name))
+			} else {
+				ce.warnUnused(param.Name, fmt.Sprintf("parameter %s is assigned but never read", param.Name.Name))
+			}
 		}
-	case "type":
-		if ce.tknzr.token().lex == Keyword {
-			if ce.tokenValue() != "int" &&
-				ce.tokenValue() != "boolean" && ce.tokenValue() != "char" {
-				ce.expected("type : int, boolean or char")
+	}
+	for _, varDec := range dec.Body.Vars {
+		for _, name := range varDec.Names {
+			if item, ok := ce.declared(name); ok && item.reads == 0 {
+				if item.writes == 0 {
+					ce.warnUnused(name, fmt.Sprintf("unused variable %s", name.Name))
+				} else {
+					ce.warnUnused(name, fmt.Sprintf("variable %s is assigned but never read", name.Name))
+				}
 			}
-		} else if ce.tknzr.token().lex != Identifier {
-			// className
-			ce.expected("type or className")
 		}
-	default:
-		if expected != ce.tokenValue() {
-			ce.expected(expected)
+	}
+}
+
+// declared finds the symbol declared by name, names declared again (already reported) are not found
+func (ce *compilationEngine) declared(name *ast.Ident) (tableItem, bool) {
+	item, ok := ce.symbolTable.find(name.Name)
+	return item, ok && item.span == ast.SpanOf(name)
+}
+
+// warnUnused reports an unused declaration, unless a jack:unused comment marks it as intentional
+func (ce *compilationEngine) warnUnused(name *ast.Ident, message string) {
+	if ce.suppressed[name.NamePos.Line] {
+		return
+	}
+	ce.report(diag.Warnf(ast.SpanOf(name), "%s", message).
+		WithHelp("add a '// jack:unused' comment to the declaration if it is intentional"))
+}
+
+// suppressedLines lines covered by the jack:unused comments, a comment applies to its own lines
+// and, unless it follows code, to the next one
+func suppressedLines(comments []*ast.Comment) map[int]bool {
+	lines := make(map[int]bool)
+	for _, comment := range comments {
+		if !strings.Contains(comment.Text, "jack:unused") {
+			continue
+		}
+		last := comment.End().Line
+		if !comment.Trailing {
+			last++
+		}
+		for line := comment.Pos().Line; line <= last; line++ {
+			lines[line] = true
+		}
+	}
+	return lines
+}
+
+// declare defines a variable, reporting names already declared in the same scope and (when enabled)
+// locals and parameters shadowing a class variable
+func (ce *compilationEngine) declare(name *ast.Ident, ttype, kind string) {
+	if ce.warnShadow && (kind == "argument" || kind == "local") {
+		if item, ok := ce.symbolTable.find(name.Name); ok && (item.kind == "static" || item.kind == "this") {
+			ce.report(diag.Warnf(ast.SpanOf(name), "%s %s shadows %s %s", describeKind(kind), name.Name, describeKind(item.kind), name.Name).
+				WithNote("", item.span, "%s is declared here", name.Name))
 		}
 	}
+	if prev, ok := ce.symbolTable.declare(name.Name, ttype, kind, ast.SpanOf(name)); !ok {
+		ce.report(diag.Errorf("compiler", ast.SpanOf(name), "%s is already declared", name.Name).
+			WithNote("", prev.span, "previous declaration of %s", name.Name))
+	}
+}
+
+// describeKind name of the kind of a variable, as declared (e.g. field for the this segment)
+func describeKind(kind string) string {
+	switch kind {
+	case "this":
+		return "field"
+	case "argument":
+		return "parameter"
+	case "local":
+		return "variable"
+	}
+	return kind
+}
 
-	// advance tokenizer
-	ce.tknzr.advance()
+// lookup finds a variable in scope, reporting undeclared variables and fields used by functions
+func (ce *compilationEngine) lookup(ident *ast.Ident) (tableItem, bool) {
+	varTbl, ok := ce.symbolTable.find(ident.Name)
+	if !ok {
+		ce.undeclared(ident)
+		return varTbl, false
+	}
+	ce.checkFieldAccess(ident, varTbl)
+	return varTbl, true
 }
 
-func (ce *compilationEngine) debug() {
-	if !ce.isDebugEnabled {
+// checkFieldAccess reports fields used by a function, pointer 0 is never set so they would read
+// random memory
+func (ce *compilationEngine) checkFieldAccess(ident *ast.Ident, varTbl tableItem) {
+	if varTbl.kind != "this" || ce.subroutine.Kind != "function" {
 		return
 	}
+	ce.report(ce.inFunction(diag.Errorf("compiler", ast.SpanOf(ident), "cannot use field %s in a function", ident.Name).
+		WithHelp("functions have no this, declare %s as a method or pass the object as an argument", ce.subroutine.Name.Name)))
+}
+
+// inFunction attaches a note pointing at the declaration of the function being compiled
+func (ce *compilationEngine) inFunction(d *diag.Diagnostic) *diag.Diagnostic {
+	return d.WithNote("", ast.SpanOf(ce.subroutine.Name), "%s.%s is a function", ce.className, ce.subroutine.Name.Name)
+}
+
+func (ce *compilationEngine) undeclared(ident *ast.Ident) {
+	ce.report(diag.Errorf("compiler", ast.SpanOf(ident), "undeclared var %s", ident.Name))
 }
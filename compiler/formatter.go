@@ -0,0 +1,268 @@
+package compiler
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/Dudssource/dd-jack-compiler/compiler/ast"
+	"github.com/Dudssource/dd-jack-compiler/compiler/diag"
+)
+
+// Format writes src with the canonical layout: 4 spaces indentation, one declaration or statement
+// per line and spaces around the binary operators. Comments and single blank lines are kept, a class
+// with syntax errors is not written and its diagnostics are returned instead
+func Format(dst io.Writer, src io.Reader) (diag.List, error) {
+	class, diagnostics := newParser(newTokenizer(src)).parse()
+	if diagnostics.Err() != nil {
+		return diagnostics, nil
+	}
+
+	f := &formatter{comments: class.Comments}
+	f.class(class)
+	for _, line := range f.lines {
+		if _, err := fmt.Fprintln(dst, line); err != nil {
+			return diagnostics, err
+		}
+	}
+	return diagnostics, nil
+}
+
+type formatter struct {
+	lines     []string
+	code      string // last line of code written, without its trailing comment
+	depth     int
+	comments  []*ast.Comment // not written yet
+	lastLine  int            // source line of the last element written
+	blankLine bool           // a blank line separates the next element from the previous one
+}
+
+func (f *formatter) class(class *ast.Class) {
+	// <class>
+	f.node(class.ClassPos)
+	f.line("class %s {", class.Name.Name)
+	f.lastLine = class.Name.Pos().Line
+	f.depth++
+	{
+		for _, dec := range class.Vars {
+			f.node(dec.Pos())
+			f.line("%s %s %s;", dec.Kind, dec.Type.Name, joinNames(dec.Names))
+			f.lastLine = dec.End().Line
+		}
+		for i, dec := range class.Subroutines {
+			// subroutines are always set apart
+			f.trailing(dec.Pos())
+			f.blankLine = i > 0 || len(class.Vars) > 0
+			f.subroutine(dec)
+		}
+		f.flush(class.Rbrace)
+	}
+	f.depth--
+	f.line("}")
+	f.lastLine = class.Rbrace.Line
+
+	// comments following the class
+	f.flush(ast.Pos{Offset: math.MaxInt})
+	// </class>
+}
+
+func (f *formatter) subroutine(dec *ast.SubroutineDec) {
+	params := make([]string, 0, len(dec.Params))
+	for _, param := range dec.Params {
+		params = append(params, param.Type.Name+" "+param.Name.Name)
+	}
+
+	f.node(dec.Pos())
+	f.line("%s %s %s(%s) {", dec.Kind, dec.ReturnType.Name, dec.Name.Name, strings.Join(params, ", "))
+	f.lastLine = dec.Body.Lbrace.Line
+	f.depth++
+	{
+		for _, varDec := range dec.Body.Vars {
+			f.node(varDec.Pos())
+			f.line("var %s %s;", varDec.Type.Name, joinNames(varDec.Names))
+			f.lastLine = varDec.End().Line
+		}
+		f.statements(dec.Body.Statements)
+		f.flush(dec.Body.Rbrace)
+	}
+	f.depth--
+	f.line("}")
+	f.lastLine = dec.Body.Rbrace.Line
+}
+
+func (f *formatter) statements(stmts []ast.Stmt) {
+	for _, stmt := range stmts {
+		f.node(stmt.Pos())
+		switch s := stmt.(type) {
+		case *ast.LetStmt:
+			target := s.Name.Name
+			if s.Index != nil {
+				target += "[" + f.expr(s.Index) + "]"
+			}
+			f.line("let %s = %s;", target, f.expr(s.Value))
+		case *ast.DoStmt:
+			f.line("do %s;", f.expr(s.Call))
+		case *ast.ReturnStmt:
+			if s.Value == nil {
+				f.line("return;")
+			} else {
+				f.line("return %s;", f.expr(s.Value))
+			}
+		case *ast.WhileStmt:
+			f.line("while (%s) {", f.expr(s.Cond))
+			f.block(s.Cond.End().Line, s.Body, s.Rbrace)
+		case *ast.IfStmt:
+			f.line("if (%s) {", f.expr(s.Cond))
+			if !s.HasElse {
+				f.block(s.Cond.End().Line, s.Then, s.Rbrace)
+				break // switch
+			}
+			f.block(s.Cond.End().Line, s.Then, s.ThenRbrace)
+			// comments between } and else stay where they are, else then starts a line of its own
+			f.flush(s.ElsePos)
+			if f.lines[len(f.lines)-1] == f.code {
+				f.lines[len(f.lines)-1] += " else {"
+			} else {
+				f.line("else {")
+			}
+			f.block(s.ElsePos.Line, s.Else, s.Rbrace)
+		}
+		f.lastLine = stmt.End().Line
+	}
+}
+
+// block writes the statements of a block opened on line, up to its closing brace
+func (f *formatter) block(line int, stmts []ast.Stmt, rbrace ast.Pos) {
+	f.lastLine = line
+	f.depth++
+	f.statements(stmts)
+	f.flush(rbrace)
+	f.depth--
+	f.line("}")
+	f.lastLine = rbrace.Line
+}
+
+// expr expressions are written on a single line
+func (f *formatter) expr(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.BinaryExpr:
+		return f.expr(e.X) + " " + e.Op + " " + f.expr(e.Y)
+	case *ast.UnaryExpr:
+		return e.Op + f.expr(e.X)
+	case *ast.ParenExpr:
+		return "(" + f.expr(e.X) + ")"
+	case *ast.IntLit:
+		return e.Value
+	case *ast.StringLit:
+		return `"` + e.Value + `"`
+	case *ast.KeywordLit:
+		return e.Value
+	case *ast.VarRef:
+		return e.Name.Name
+	case *ast.IndexExpr:
+		return e.Name.Name + "[" + f.expr(e.Index) + "]"
+	case *ast.CallExpr:
+		args := make([]string, 0, len(e.Args))
+		for _, arg := range e.Args {
+			args = append(args, f.expr(arg))
+		}
+		name := e.Name.Name
+		if e.Receiver != nil {
+			name = e.Receiver.Name + "." + name
+		}
+		return name + "(" + strings.Join(args, ", ") + ")"
+	}
+	// syntax errors are not formatted
+	panic(fmt.Sprintf("unexpected expression %T", expr))
+}
+
+// node writes the comments preceding a declaration or statement starting at pos, keeping a blank
+// line found before it
+func (f *formatter) node(pos ast.Pos) {
+	f.flush(pos)
+	f.gap(pos.Line)
+}
+
+// flush writes the comments before pos, trailing comments stay at the end of their line
+func (f *formatter) flush(pos ast.Pos) {
+	for len(f.comments) > 0 && f.comments[0].Slash.Offset < pos.Offset {
+		comment := f.comments[0]
+		f.comments = f.comments[1:]
+
+		if comment.Trailing && len(f.lines) > 0 {
+			f.lines[len(f.lines)-1] += " " + strings.TrimRight(comment.Text, " \t\r")
+			f.lastLine = comment.End().Line
+			continue
+		}
+
+		f.gap(comment.Slash.Line)
+		for i, text := range strings.Split(comment.Text, "\n") {
+			text = strings.TrimRight(text, " \t\r")
+			switch trimmed := strings.TrimLeft(text, " \t"); {
+			case i == 0:
+				f.line("%s", text)
+			case strings.HasPrefix(trimmed, "*"):
+				// block comment continuation, aligned with the opening /*
+				f.line(" %s", trimmed)
+			default:
+				f.lines = append(f.lines, text)
+			}
+		}
+		f.code = ""
+		f.lastLine = comment.End().Line
+	}
+}
+
+// trailing writes the trailing comments before pos only, along with the line comments continuing
+// them on the following lines when a blank line sets the run apart from what comes next
+func (f *formatter) trailing(pos ast.Pos) {
+	for len(f.comments) > 0 && f.comments[0].Trailing && f.comments[0].Slash.Offset < pos.Offset {
+		f.flush(f.comments[0].End())
+
+		run, line := 0, f.lastLine
+		for _, comment := range f.comments {
+			if comment.Slash.Offset >= pos.Offset || comment.Trailing ||
+				!strings.HasPrefix(comment.Text, "//") || comment.Slash.Line != line+1 {
+				break
+			}
+			run++
+			line = comment.Slash.Line
+		}
+		next := pos.Line
+		if run < len(f.comments) && f.comments[run].Slash.Offset < pos.Offset {
+			next = f.comments[run].Slash.Line
+		}
+		if run > 0 && next > line+1 {
+			f.flush(f.comments[run-1].End())
+		}
+	}
+}
+
+// gap keeps a blank line between the previous element and the one starting at line
+func (f *formatter) gap(line int) {
+	if f.lastLine > 0 && line > f.lastLine+1 {
+		f.blankLine = true
+	}
+}
+
+// line writes a line at the current indentation
+func (f *formatter) line(format string, args ...any) {
+	if f.blankLine && len(f.lines) > 0 {
+		last := f.lines[len(f.lines)-1]
+		if last != "" && !strings.HasSuffix(f.code, "{") {
+			f.lines = append(f.lines, "")
+		}
+	}
+	f.blankLine = false
+	f.code = strings.Repeat("    ", f.depth) + fmt.Sprintf(format, args...)
+	f.lines = append(f.lines, f.code)
+}
+
+func joinNames(names []*ast.Ident) string {
+	s := make([]string, 0, len(names))
+	for _, name := range names {
+		s = append(s, name.Name)
+	}
+	return strings.Join(s, ", ")
+}
@@ -0,0 +1,237 @@
+package compiler
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// compileFile VM code of a single file, the other classes are unknown
+func compileFile(t *testing.T, src string) string {
+	t.Helper()
+	var vm strings.Builder
+	if err := NewJackAnalyser(strings.NewReader(src), &vm).WithFileNameCheck(false).Run(); err != nil {
+		t.Fatal(err)
+	}
+	return vm.String()
+}
+
+func format(t *testing.T, src string) string {
+	t.Helper()
+	var dst strings.Builder
+	diagnostics, err := Format(&dst, strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := diagnostics.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return dst.String()
+}
+
+// TestFormatRoundTrip formats every jack file of testdata twice, the formatted files must compile to
+// the same VM code and be left as they are by the second pass
+func TestFormatRoundTrip(t *testing.T) {
+	paths, err := filepath.Glob("../testdata/*/*/*/*.jack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	analyzer, err := filepath.Glob("../testdata/analyzer/*.jack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths = append(paths, analyzer...)
+	if len(paths) == 0 {
+		t.Fatal("no jack files found in testdata")
+	}
+
+	for _, path := range paths {
+		t.Run(path, func(t *testing.T) {
+			src, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			formatted := format(t, string(src))
+			if again := format(t, formatted); again != formatted {
+				t.Errorf("formatting is not idempotent, got\n%s\nafter\n%s", again, formatted)
+			}
+			if compileFile(t, formatted) != compileFile(t, string(src)) {
+				t.Error("the formatted file compiles to another VM code")
+			}
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := map[string]struct {
+		src  string
+		want string
+	}{
+		"layout": {
+			src: "class Main{function void main(){var int x,y;let x=1+(2*3);let y=-x;if(x<y){do Output.printInt(x);}else{return;}while(~(x=0)){let x=x-1;}return;}}",
+			want: `class Main {
+    function void main() {
+        var int x, y;
+        let x = 1 + (2 * 3);
+        let y = -x;
+        if (x < y) {
+            do Output.printInt(x);
+        } else {
+            return;
+        }
+        while (~(x = 0)) {
+            let x = x - 1;
+        }
+        return;
+    }
+}
+`,
+		},
+		"comments and blank lines": {
+			src: `// Main
+class Main {
+    field int x; // x
+
+
+    /** constructor */
+    constructor Main new() {
+        let x = 1;
+
+        return this;  /* done */
+    }
+}
+`,
+			want: `// Main
+class Main {
+    field int x; // x
+
+    /** constructor */
+    constructor Main new() {
+        let x = 1;
+
+        return this; /* done */
+    }
+}
+`,
+		},
+		"comment after an opening brace": {
+			src: `class Main {
+    function void main(boolean b) {
+        if (b) { // cond
+
+            do Output.printInt(1);
+        }
+        return;
+    }
+}
+`,
+			want: `class Main {
+    function void main(boolean b) {
+        if (b) { // cond
+            do Output.printInt(1);
+        }
+        return;
+    }
+}
+`,
+		},
+		"comments between } and else": {
+			src: `class Main {
+    function void main(boolean b) {
+        if (b) {
+            do Output.printInt(1);
+        } // between
+        else {
+            do Output.printInt(2);
+        }
+        if (b) {
+            do Output.printInt(1);
+        }
+        // own line
+        else {
+            do Output.printInt(2);
+        }
+        return;
+    }
+}
+`,
+			want: `class Main {
+    function void main(boolean b) {
+        if (b) {
+            do Output.printInt(1);
+        } // between
+        else {
+            do Output.printInt(2);
+        }
+        if (b) {
+            do Output.printInt(1);
+        }
+        // own line
+        else {
+            do Output.printInt(2);
+        }
+        return;
+    }
+}
+`,
+		},
+		"trailing comment continued on the next line": {
+			src: `class Main {
+    field int direction;  // the direction: 
+                          // 0=none, 1=up
+
+    /** Runs. */
+    method void run() {
+        return;
+    } // run
+      // done
+
+    method void stop() {
+        return;
+    }
+}
+`,
+			want: `class Main {
+    field int direction; // the direction:
+    // 0=none, 1=up
+
+    /** Runs. */
+    method void run() {
+        return;
+    } // run
+    // done
+
+    method void stop() {
+        return;
+    }
+}
+`,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := format(t, test.src)
+			if got != test.want {
+				t.Errorf("got\n%s\nwant\n%s", got, test.want)
+			}
+			if again := format(t, got); again != got {
+				t.Errorf("formatting is not idempotent, got\n%s", again)
+			}
+		})
+	}
+}
+
+func TestFormatSyntaxError(t *testing.T) {
+	var dst strings.Builder
+	diagnostics, err := Format(&dst, strings.NewReader("class Main {\n    function void main() {\n        let x = ;\n    }\n}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diagnostics.Err() == nil {
+		t.Error("no syntax error reported")
+	}
+	if dst.Len() > 0 {
+		t.Errorf("a class with syntax errors was written:\n%s", dst.String())
+	}
+}
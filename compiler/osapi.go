@@ -0,0 +1,112 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/Dudssource/dd-jack-compiler/compiler/ast"
+)
+
+// JackOSAPIVersion edition of the Jack OS API described by jackOSAPI
+const JackOSAPIVersion = "nand2tetris-2.0"
+
+// jackOSAPI signatures of the standard Jack OS subroutines (The Elements of Computing Systems,
+// appendix "The Jack OS API"), written in Jack so they're loaded by the parser
+var jackOSAPI = map[string][]string{
+	"Math": {
+		"function void init()",
+		"function int abs(int x)",
+		"function int multiply(int x, int y)",
+		"function int divide(int x, int y)",
+		"function int min(int x, int y)",
+		"function int max(int x, int y)",
+		"function int sqrt(int x)",
+	},
+	"String": {
+		"constructor String new(int maxLength)",
+		"method void dispose()",
+		"method int length()",
+		"method char charAt(int j)",
+		"method void setCharAt(int j, char c)",
+		"method String appendChar(char c)",
+		"method void eraseLastChar()",
+		"method int intValue()",
+		"method void setInt(int val)",
+		"function char backSpace()",
+		"function char doubleQuote()",
+		"function char newLine()",
+	},
+	"Array": {
+		"function Array new(int size)",
+		"method void dispose()",
+	},
+	"Output": {
+		"function void init()",
+		"function void moveCursor(int i, int j)",
+		"function void printChar(char c)",
+		"function void printString(String s)",
+		"function void printInt(int i)",
+		"function void println()",
+		"function void backSpace()",
+	},
+	"Screen": {
+		"function void init()",
+		"function void clearScreen()",
+		"function void setColor(boolean b)",
+		"function void drawPixel(int x, int y)",
+		"function void drawLine(int x1, int y1, int x2, int y2)",
+		"function void drawRectangle(int x1, int y1, int x2, int y2)",
+		"function void drawCircle(int x, int y, int r)",
+	},
+	"Keyboard": {
+		"function void init()",
+		"function char keyPressed()",
+		"function char readChar()",
+		"function String readLine(String message)",
+		"function int readInt(String message)",
+	},
+	"Memory": {
+		"function void init()",
+		"function int peek(int address)",
+		"function void poke(int address, int value)",
+		"function Array alloc(int size)",
+		"function void deAlloc(Array o)",
+	},
+	"Sys": {
+		"function void init()",
+		"function void halt()",
+		"function void error(int errorCode)",
+		"function void wait(int duration)",
+	},
+}
+
+// jackOSClasses signatures of the bundled OS, parsed once and shared by every index
+var jackOSClasses = sync.OnceValue(func() map[string]*classInfo {
+	idx := &programIndex{classes: make(map[string]*classInfo)}
+
+	for name, signatures := range jackOSAPI {
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "class %s {\n", name)
+		for _, signature := range signatures {
+			fmt.Fprintf(&sb, "%s {}\n", signature)
+		}
+		sb.WriteString("}")
+
+		class, diagnostics := newParser(newTokenizer(strings.NewReader(sb.String()))).parse()
+		if err := diagnostics.Err(); err != nil {
+			panic(fmt.Sprintf("invalid jack OS API for %s : %s", name, err.Error()))
+		}
+		idx.add("", class)
+
+		// the declarations are not backed by a file
+		cls := idx.classes[name]
+		cls.builtin = true
+		cls.span = ast.Span{}
+		for _, sub := range cls.subroutines {
+			sub.span = ast.Span{}
+		}
+	}
+
+	return idx.classes
+})
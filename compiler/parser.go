@@ -0,0 +1,612 @@
+package compiler
+
+import (
+	"io"
+	"sort"
+
+	"github.com/Dudssource/dd-jack-compiler/compiler/ast"
+	"github.com/Dudssource/dd-jack-compiler/compiler/diag"
+)
+
+// Parse reads a single jack class from src and returns its syntax tree, the error is a diag.List
+func Parse(src io.Reader) (*ast.Class, error) {
+	class, diagnostics := newParser(newTokenizer(src)).parse()
+	return class, diagnostics.Err()
+}
+
+var (
+	// statementSync tokens where the parser resumes after an error inside a subroutine body
+	statementSync = map[string]bool{
+		"let": true, "do": true, "if": true, "while": true, "return": true, "var": true,
+		"constructor": true, "function": true, "method": true, "static": true, "field": true,
+		"}": true,
+	}
+	// declarationSync tokens where the parser resumes after an error at the class level
+	declarationSync = map[string]bool{
+		"constructor": true, "function": true, "method": true, "static": true, "field": true,
+	}
+)
+
+type parser struct {
+	tknzr       *jackTokenizer
+	diagnostics diag.List
+	prevEnd     ast.Pos // end of the last token consumed
+	panicking   bool    // an error was reported and the parser is not synchronized yet
+}
+
+func newParser(tknzr *jackTokenizer) *parser {
+	return &parser{
+		tknzr: tknzr,
+	}
+}
+
+func (p *parser) parse() (*ast.Class, diag.List) {
+
+	// start token
+	p.tknzr.advance()
+
+	// parse class
+	class := p.parseClass()
+
+	// nothing but comments may follow the class
+	if p.tknzr.token().lex != EOF {
+		p.expected("end of file")
+	}
+	class.Comments = p.tknzr.comments
+
+	// lexical errors first, ordered by position
+	diagnostics := append(p.tknzr.diagnostics, p.diagnostics...)
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		return diagnostics[i].Span.Start.Offset < diagnostics[j].Span.Start.Offset
+	})
+
+	return class, diagnostics
+}
+
+func (p *parser) parseClass() *ast.Class {
+	// <class>
+	class := &ast.Class{ClassPos: p.pos()}
+	p.check("class")
+	{
+		class.Name = p.ident(p.check("className"))
+		p.check("{")
+		{
+			// classVarDec* subroutineDec*
+			for {
+				p.sync(declarationSync)
+				if p.tokenValue() == "}" || p.tknzr.token().lex == EOF {
+					break // for
+				}
+				switch p.tokenValue() {
+				case "static", "field":
+					if len(class.Subroutines) > 0 {
+						p.report(diag.Errorf("syntax", p.tknzr.token().span, "class variables must be declared before the subroutines"))
+					}
+					class.Vars = append(class.Vars, p.parseClassVarDec())
+					continue
+				case "constructor", "function", "method":
+					class.Subroutines = append(class.Subroutines, p.parseSubroutineDec())
+					continue
+				}
+				p.expected("classVarDec or subroutineDec")
+			}
+		}
+		class.Rbrace = p.pos()
+		p.check("}")
+	}
+	// </class>
+	return class
+}
+
+func (p *parser) parseClassVarDec() *ast.ClassVarDec {
+	// <classVarDec>
+	dec := &ast.ClassVarDec{KindPos: p.pos(), Kind: p.tokenValue()}
+	p.check(p.tokenValue()) // static, field
+
+	// type
+	dec.Type = p.ident(p.check("type"))
+
+	// varName (',' varName)*
+	dec.Names = p.parseVarNames()
+
+	dec.Semicolon = p.pos()
+	p.check(";")
+	// </classVarDec>
+	return dec
+}
+
+func (p *parser) parseSubroutineDec() *ast.SubroutineDec {
+	// <subroutineDec>
+	dec := &ast.SubroutineDec{KindPos: p.pos(), Kind: p.tokenValue()}
+
+	// "constructor", "function", "method"
+	p.check(p.tokenValue())
+
+	if p.tokenValue() == "void" {
+		dec.ReturnType = p.ident(p.check("void"))
+	} else {
+		dec.ReturnType = p.ident(p.check("type"))
+	}
+
+	dec.Name = p.ident(p.check("subroutineName"))
+	p.check("(")
+	dec.Params = p.parseParameterList()
+	p.check(")")
+
+	dec.Body = p.parseSubroutineBody()
+	// </subroutineDec>
+	return dec
+}
+
+func (p *parser) parseParameterList() []*ast.Param {
+	// <parameterList>
+	params := make([]*ast.Param, 0)
+	{
+		if p.tokenValue() != ")" {
+
+			params = append(params, p.parseParameter())
+
+			for p.tokenValue() == "," {
+				p.check(",")
+				params = append(params, p.parseParameter())
+			}
+		}
+	}
+	// </parameterList>
+	return params
+}
+
+func (p *parser) parseParameter() *ast.Param {
+	// type varName
+	param := &ast.Param{}
+	param.Type = p.ident(p.check("type"))
+	param.Name = p.ident(p.check("varName"))
+	return param
+}
+
+func (p *parser) parseSubroutineBody() *ast.SubroutineBody {
+	// <subroutineBody>
+	body := &ast.SubroutineBody{Lbrace: p.pos()}
+	{
+		p.check("{")
+		{
+			for p.tokenValue() == "var" {
+				// <varDec>
+				dec := &ast.VarDec{VarPos: p.pos()}
+				p.check("var")
+
+				// type
+				dec.Type = p.ident(p.check("type"))
+
+				// varName (',' varName)*
+				dec.Names = p.parseVarNames()
+
+				dec.Semicolon = p.pos()
+				p.check(";")
+				// </varDec>
+				body.Vars = append(body.Vars, dec)
+			}
+
+			body.Statements = p.parseStatements()
+		}
+		body.Rbrace = p.pos()
+		p.check("}")
+	}
+	// </subroutineBody>
+	return body
+}
+
+func (p *parser) parseVarNames() []*ast.Ident {
+	// varName
+	names := []*ast.Ident{p.ident(p.check("varName"))}
+
+	// (','varName)*
+	for p.tokenValue() == "," {
+		p.check(",")
+		names = append(names, p.ident(p.check("varName")))
+	}
+	return names
+}
+
+func (p *parser) parseStatements() []ast.Stmt {
+	// <statements>
+	stmts := make([]ast.Stmt, 0)
+	{
+		for p.tknzr.hasMoreTokens() {
+			p.sync(statementSync)
+			if p.tknzr.token().lex != Keyword {
+				break // for
+			}
+			switch p.tokenValue() {
+			case "while":
+				stmts = append(stmts, p.parseWhile())
+				continue // for
+			case "let":
+				stmts = append(stmts, p.parseLet())
+				continue // for
+			case "if":
+				stmts = append(stmts, p.parseIf())
+				continue // for
+			case "do":
+				stmts = append(stmts, p.parseDo())
+				continue // for
+			case "return":
+				stmts = append(stmts, p.parseReturn())
+				continue // for
+			}
+			break // for
+		}
+	}
+	// </statements>
+	return stmts
+}
+
+func (p *parser) parseLet() *ast.LetStmt {
+	// <letStatement>
+	stmt := &ast.LetStmt{LetPos: p.pos()}
+	{
+		p.check("let")
+		stmt.Name = p.ident(p.check("varName"))
+
+		if p.tokenValue() == "[" {
+			p.check("[")
+			stmt.Index = p.parseExpression()
+			p.check("]")
+		}
+		p.check("=")
+		stmt.Value = p.parseExpression()
+		stmt.Semicolon = p.pos()
+		p.check(";")
+	}
+	// </letStatement>
+	return stmt
+}
+
+func (p *parser) parseReturn() *ast.ReturnStmt {
+	// <returnStatement>
+	stmt := &ast.ReturnStmt{ReturnPos: p.pos()}
+	p.check("return")
+	// expression?
+	if p.tokenValue() != ";" {
+		stmt.Value = p.parseExpression()
+	}
+	stmt.Semicolon = p.pos()
+	p.check(";")
+	// </returnStatement>
+	return stmt
+}
+
+func (p *parser) parseIf() *ast.IfStmt {
+	// <ifStatement>
+	stmt := &ast.IfStmt{IfPos: p.pos()}
+	{
+		p.check("if")
+		p.check("(")
+		stmt.Cond = p.parseExpression()
+		p.check(")")
+		p.check("{")
+		stmt.Then = p.parseStatements()
+		stmt.ThenRbrace = p.pos()
+		stmt.Rbrace = stmt.ThenRbrace
+		p.check("}")
+
+		// ('else''{statements'}')?
+		if p.tokenValue() == "else" {
+			stmt.HasElse = true
+			stmt.ElsePos = p.pos()
+			p.check("else")
+			p.check("{")
+			stmt.Else = p.parseStatements()
+			stmt.Rbrace = p.pos()
+			p.check("}")
+		}
+	}
+	// </ifStatement>
+	return stmt
+}
+
+func (p *parser) parseWhile() *ast.WhileStmt {
+	// <whileStatement>
+	stmt := &ast.WhileStmt{WhilePos: p.pos()}
+	{
+		p.check("while")
+		p.check("(")
+		stmt.Cond = p.parseExpression()
+		p.check(")")
+		p.check("{")
+		stmt.Body = p.parseStatements()
+		stmt.Rbrace = p.pos()
+		p.check("}")
+	}
+	// </whileStatement>
+	return stmt
+}
+
+func (p *parser) parseDo() *ast.DoStmt {
+	// <doStatement>
+	stmt := &ast.DoStmt{DoPos: p.pos()}
+	{
+		p.check("do")
+		// subroutineCall
+		stmt.Call = p.parseSubroutineCall(p.ident(p.check("identifier")))
+		stmt.Semicolon = p.pos()
+		p.check(";")
+	}
+	// </doStatement>
+	return stmt
+}
+
+func (p *parser) parseExpression() ast.Expr {
+	// <expression>
+	// term
+	expr := p.parseTerm()
+	{
+		// optional (op term)*
+		for p.tknzr.token().lex == Symbol {
+			switch p.tokenValue() {
+			// op
+			case "+", "-", "=", ">", "<", "*", "/", "&", "|":
+				bin := &ast.BinaryExpr{X: expr, OpPos: p.pos(), Op: p.tokenValue()}
+				p.tknzr.advance()
+				bin.Y = p.parseTerm()
+				expr = bin
+				continue
+			}
+			break // for
+		}
+	}
+	// </expression>
+	return expr
+}
+
+func (p *parser) parseTerm() ast.Expr {
+	// <term>
+	switch p.tknzr.token().lex {
+	case Identifier:
+		// varName, className, subroutineName
+		identifier := p.ident(p.check("identifier"))
+		switch p.tokenValue() {
+		case "[":
+			p.check("[")
+			expr := &ast.IndexExpr{Name: identifier, Index: p.parseExpression()}
+			expr.Rbrack = p.pos()
+			p.check("]")
+			return expr
+		case "(", ".":
+			return p.parseSubroutineCall(identifier)
+		default:
+			return &ast.VarRef{Name: identifier}
+		}
+	case IntConst:
+		return p.parseIntConst(false)
+	case StringConst:
+		return &ast.StringLit{ValuePos: p.pos(), Value: p.check("constant").value}
+	case Keyword: // keyword constant
+		switch p.tokenValue() {
+		case "true", "false", "null", "this":
+			return &ast.KeywordLit{ValuePos: p.pos(), Value: p.check(p.tokenValue()).value}
+		default:
+			p.expected("keywordConstant")
+		}
+	case Symbol:
+
+		// (expression)
+		if p.tokenValue() == "(" {
+			expr := &ast.ParenExpr{Lparen: p.pos()}
+			p.check("(")
+			expr.X = p.parseExpression()
+			expr.Rparen = p.pos()
+			p.check(")")
+			return expr
+
+			// unaryOp
+		} else if p.tokenValue() == "-" || p.tokenValue() == "~" {
+			expr := &ast.UnaryExpr{OpPos: p.pos(), Op: p.tokenValue()}
+			p.check(p.tokenValue()) // unaryOp - ~
+			if expr.Op == "-" && p.tknzr.token().lex == IntConst {
+				expr.X = p.parseIntConst(true)
+			} else {
+				expr.X = p.parseTerm()
+			}
+			return expr
+		} else {
+			p.expected("parenthesis or unaryOp")
+		}
+	default:
+		p.expected("varName or constant")
+	}
+	// </term>
+
+	// keep the tree well formed after an error
+	return &ast.BadExpr{From: p.tknzr.token().span.Start, To: p.tknzr.token().span.End}
+}
+
+// parseIntConst parses an integer constant validating its range, negated is set when the constant
+// is the operand of an unary minus (allowing -32768)
+func (p *parser) parseIntConst(negated bool) *ast.IntLit {
+	tkn := p.tknzr.token()
+	lit := &ast.IntLit{ValuePos: p.pos(), Value: p.check("constant").value}
+	if tkn.invalid {
+		// reported by the tokenizer
+		return lit
+	}
+	if value := lit.IntValue(); value > maxIntConst && (!negated || value > maxIntConst+1) {
+		d := diag.Errorf("syntax", tkn.span, "integer constant %s is out of range", lit.Value).
+			WithHelp("integer constants must be between 0 and %d", maxIntConst)
+		if value == maxIntConst+1 {
+			d.WithHelp("integer constants must be between 0 and %d, %d is only allowed negated (-%d)", maxIntConst, value, value)
+		}
+		p.report(d)
+	}
+	return lit
+}
+
+// parseSubroutineCall parses the remaining of a subroutine call, after its first identifier
+func (p *parser) parseSubroutineCall(identifier *ast.Ident) *ast.CallExpr {
+	call := &ast.CallExpr{Name: identifier}
+	if p.tokenValue() == "." {
+		p.check(".")
+		call.Receiver = identifier
+		call.Name = p.ident(p.check("subroutineName"))
+	}
+	p.check("(")
+	call.Args = p.parseExpressionList()
+	call.Rparen = p.pos()
+	p.check(")")
+	return call
+}
+
+func (p *parser) parseExpressionList() []ast.Expr {
+	// <expressionList>
+	args := make([]ast.Expr, 0)
+	{
+		// handle empty expression list
+		if p.tokenValue() != ")" {
+			args = append(args, p.parseExpression())
+			// (, expression)*
+			for p.tokenValue() == "," {
+				p.check(",")
+				args = append(args, p.parseExpression())
+			}
+		}
+	}
+	// </expressionList>
+	return args
+}
+
+// expected reports the current token as unexpected and enters panic mode, errors are not
+// reported while panicking so a single mistake doesn't cascade
+func (p *parser) expected(expected string) {
+	if p.panicking {
+		return
+	}
+	p.panicking = true
+	tkn := p.tknzr.token()
+	if p.afterLexicalError() {
+		// most likely caused by the skipped characters
+		return
+	}
+	if tkn.lex == EOF {
+		if p.tknzr.truncated {
+			// already reported by the tokenizer
+			return
+		}
+		p.report(diag.Errorf("syntax", tkn.span, "unexpected end of file, expected %s", quoteExpected(expected)))
+		return
+	}
+	d := diag.Errorf("syntax", tkn.span, "expected %s, got %s", quoteExpected(expected), tkn.describe())
+	if expected == ";" && p.prevEnd.IsValid() {
+		// point right after the statement missing the semicolon
+		d.Span = ast.Span{Start: p.prevEnd, End: p.prevEnd}
+		d.WithHelp("did you forget a ';'?")
+	}
+	p.report(d)
+}
+
+// afterLexicalError reports whether the tokenizer found an error after the last token consumed
+func (p *parser) afterLexicalError() bool {
+	n := len(p.tknzr.diagnostics)
+	return n > 0 && p.tknzr.diagnostics[n-1].Span.Start.Offset >= p.prevEnd.Offset
+}
+
+func (p *parser) report(d *diag.Diagnostic) {
+	p.diagnostics = append(p.diagnostics, d)
+}
+
+// sync leaves panic mode skipping tokens up to the next synchronization point, a ';' is consumed
+// as it terminates the broken statement
+func (p *parser) sync(stops map[string]bool) {
+	if !p.panicking {
+		return
+	}
+	for {
+		tkn := p.tknzr.token()
+		if tkn.lex == EOF {
+			// nothing left to synchronize on, stay in panic mode so the missing tokens are not reported
+			return
+		}
+		if (tkn.lex == Keyword || tkn.lex == Symbol) && stops[tkn.value] {
+			break
+		}
+		p.tknzr.advance()
+		if tkn.lex == Symbol && tkn.value == ";" {
+			break
+		}
+	}
+	p.panicking = false
+}
+
+// quoteExpected quotes literal symbols and keywords, grammar elements (e.g. varName) are kept as is
+func quoteExpected(expected string) string {
+	if len(expected) == 1 || keywordRegex.MatchString(expected) {
+		return "'" + expected + "'"
+	}
+	return expected
+}
+
+func (p *parser) tokenValue() string {
+	return p.tknzr.token().value
+}
+
+// pos position of the current token
+func (p *parser) pos() ast.Pos {
+	return p.tknzr.token().pos()
+}
+
+func (p *parser) ident(tkn *Token) *ast.Ident {
+	return &ast.Ident{NamePos: tkn.pos(), Name: tkn.value}
+}
+
+// check validates the current token against the expected grammar element and returns it, the
+// tokenizer is only advanced when the token matches so the parser can synchronize on it
+func (p *parser) check(expected string) *Token {
+	tkn := p.tknzr.token()
+
+	// grammar element reported when the token doesn't match
+	var mismatch string
+
+	switch expected {
+	case "varName", "className", "subroutineName", "identifier":
+		if tkn.lex != Identifier {
+			mismatch = expected
+		}
+	case "constant":
+		if tkn.lex != StringConst && tkn.lex != IntConst {
+			mismatch = expected
+		}
+	case "constructor", "function", "method":
+		if tkn.lex != Keyword {
+			mismatch = expected
+		}
+	case "type":
+		if tkn.lex == Keyword {
+			if tkn.value != "int" &&
+				tkn.value != "boolean" && tkn.value != "char" {
+				mismatch = "type : int, boolean or char"
+			}
+		} else if tkn.lex != Identifier {
+			// className
+			mismatch = "type or className"
+		}
+	default:
+		if expected != tkn.value || (tkn.lex != Symbol && tkn.lex != Keyword) {
+			mismatch = expected
+		}
+	}
+
+	if mismatch != "" {
+		p.expected(mismatch)
+		return tkn
+	}
+
+	// the tokenizer already reported this token, don't cascade into syntax errors
+	if tkn.invalid {
+		p.panicking = true
+	}
+
+	// advance tokenizer
+	p.prevEnd = tkn.span.End
+	p.tknzr.advance()
+
+	return tkn
+}
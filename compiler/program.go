@@ -0,0 +1,312 @@
+package compiler
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Dudssource/dd-jack-compiler/compiler/ast"
+	"github.com/Dudssource/dd-jack-compiler/compiler/diag"
+)
+
+// subroutineInfo signature of a subroutine, as seen by the callers
+type subroutineInfo struct {
+	className  string
+	name       string
+	kind       string // constructor, function or method
+	returnType string
+	params     []paramInfo
+	fileName   string
+	span       ast.Span // name of the subroutine in its declaration
+}
+
+type paramInfo struct {
+	name  string
+	ttype string
+}
+
+// signature e.g. function void printInt(int i)
+func (sub *subroutineInfo) signature() string {
+	params := make([]string, 0, len(sub.params))
+	for _, param := range sub.params {
+		params = append(params, param.ttype+" "+param.name)
+	}
+	return fmt.Sprintf("%s %s %s(%s)", sub.kind, sub.returnType, sub.name, strings.Join(params, ", "))
+}
+
+// classInfo signatures of every subroutine declared by a class
+type classInfo struct {
+	name        string
+	fileName    string
+	span        ast.Span
+	subroutines map[string]*subroutineInfo
+	builtin     bool            // bundled Jack OS class, see jackOSAPI
+	functions   map[string]bool // class read from a VM file, only the names of its functions are known
+}
+
+// programIndex classes known while compiling, when closed every class of the program was
+// collected so calls to classes missing from the index are errors
+type programIndex struct {
+	classes map[string]*classInfo
+	closed  bool
+}
+
+func newProgramIndex(closed bool) *programIndex {
+	idx := &programIndex{
+		classes: make(map[string]*classInfo),
+		closed:  closed,
+	}
+	// the Jack OS is always available
+	for name, cls := range jackOSClasses() {
+		idx.classes[name] = cls
+	}
+	return idx
+}
+
+// add collects the signatures of a class
+func (idx *programIndex) add(fileName string, class *ast.Class) {
+	cls := &classInfo{
+		name:        class.Name.Name,
+		fileName:    fileName,
+		span:        ast.SpanOf(class.Name),
+		subroutines: make(map[string]*subroutineInfo),
+	}
+	for _, dec := range class.Subroutines {
+		sub := &subroutineInfo{
+			className:  cls.name,
+			name:       dec.Name.Name,
+			kind:       dec.Kind,
+			returnType: dec.ReturnType.Name,
+			fileName:   fileName,
+			span:       ast.SpanOf(dec.Name),
+		}
+		for _, param := range dec.Params {
+			sub.params = append(sub.params, paramInfo{name: param.Name.Name, ttype: param.Type.Name})
+		}
+		if _, ok := cls.subroutines[sub.name]; !ok {
+			cls.subroutines[sub.name] = sub
+		}
+	}
+	idx.classes[cls.name] = cls
+}
+
+// compilationUnit a parsed source file of the program
+type compilationUnit struct {
+	fileName    string
+	class       *ast.Class
+	diagnostics diag.List
+}
+
+// Program compiles a set of jack files together, the signatures of every class are collected
+// before any file is compiled so calls can be resolved across files:
+//
+//	prg := NewProgram()
+//	prg.AddFile("Main.jack", mainSrc)
+//	prg.AddFile("Square.jack", squareSrc)
+//	diagnostics := prg.Compile("Main.jack", dst)
+type Program struct {
+	index           *programIndex
+	units           map[string]*compilationUnit
+	declaredBy      map[string]*compilationUnit // first file declaring each class
+	typeCheck       TypeCheckLevel
+	dropUnreachable bool
+	warnShadow      bool
+	checkFileNames  bool
+	debug           bool
+}
+
+func NewProgram() *Program {
+	return &Program{
+		index:          newProgramIndex(true),
+		units:          make(map[string]*compilationUnit),
+		declaredBy:     make(map[string]*compilationUnit),
+		checkFileNames: true,
+	}
+}
+
+// WithTypeCheck enables the type checker (disabled by default)
+func (prg *Program) WithTypeCheck(level TypeCheckLevel) *Program {
+	prg.typeCheck = level
+	return prg
+}
+
+// WithDropUnreachable leaves the unreachable statements out of the VM code, they're reported as
+// warnings either way
+func (prg *Program) WithDropUnreachable(drop bool) *Program {
+	prg.dropUnreachable = drop
+	return prg
+}
+
+// WithShadowWarnings warns about locals and parameters shadowing a field or a static
+func (prg *Program) WithShadowWarnings(enabled bool) *Program {
+	prg.warnShadow = enabled
+	return prg
+}
+
+// WithFileNameCheck enables (default) or disables the check of the class names against the file
+// names, to be disabled when the names given to AddFile are not paths (e.g. stdin)
+func (prg *Program) WithFileNameCheck(enabled bool) *Program {
+	prg.checkFileNames = enabled
+	return prg
+}
+
+// WithDebug prints the symbol tables to stdout while compiling
+func (prg *Program) WithDebug(enabled bool) *Program {
+	prg.debug = enabled
+	return prg
+}
+
+// AddFile parses a file of the program, collecting the signatures of its class
+func (prg *Program) AddFile(fileName string, src io.Reader) {
+	class, diagnostics := newParser(newTokenizer(src)).parse()
+	unit := &compilationUnit{
+		fileName: fileName,
+		class:    class,
+	}
+	prg.units[fileName] = unit
+
+	if first, ok := prg.declaredBy[class.Name.Name]; ok && first.fileName != fileName {
+		// the first declaration stays in the index
+		diagnostics = append(diagnostics, diag.Errorf("compiler", ast.SpanOf(class.Name), "class %s is already declared", class.Name.Name).
+			WithNote(first.fileName, ast.SpanOf(first.class.Name), "previous declaration of %s", class.Name.Name))
+	} else if class.Name.Name != "" {
+		prg.declaredBy[class.Name.Name] = unit
+		prg.index.add(fileName, class)
+	}
+
+	if prg.checkFileNames {
+		if d := checkFileName(fileName, class); d != nil {
+			diagnostics = append(diagnostics, d)
+		}
+	}
+
+	diagnostics.SetFile(fileName)
+	unit.diagnostics = diagnostics
+}
+
+// checkFileName reports a class declared by a file of another name: the VM file is named after the
+// jack file while its functions are named after the class, so the program wouldn't link
+func checkFileName(fileName string, class *ast.Class) *diag.Diagnostic {
+	if fileName == "" || fileName == "-" || class.Name.Name == "" {
+		return nil
+	}
+	base := filepath.Base(fileName)
+	name := strings.TrimSuffix(base, filepath.Ext(base))
+	if name == class.Name.Name {
+		return nil
+	}
+	return diag.Errorf("compiler", ast.SpanOf(class.Name), "class %s is declared in %s", class.Name.Name, base).
+		WithHelp("rename the file to %s.jack or the class to %s, the VM code of %s is written to %s.vm", class.Name.Name, name, base, name)
+}
+
+// AddDeclarations parses a file only to collect the signatures of its class, the file is not
+// compiled and its errors are ignored (e.g. the other files of a directory when compiling a
+// single file); the declarations extend the classes of the bundled Jack OS, replacing the
+// subroutines of the same name
+func (prg *Program) AddDeclarations(fileName string, src io.Reader) {
+	class, _ := newParser(newTokenizer(src)).parse()
+	bundled, ok := prg.index.classes[class.Name.Name]
+	if ok && !bundled.builtin {
+		return
+	}
+	prg.index.add(fileName, class)
+	if ok {
+		cls := prg.index.classes[class.Name.Name]
+		for name, sub := range bundled.subroutines {
+			if _, declared := cls.subroutines[name]; !declared {
+				cls.subroutines[name] = sub
+			}
+		}
+	}
+}
+
+// AddVMDeclarations collects the classes of a VM file that has no jack file in the program (e.g.
+// a prebuilt class of the folder). Only the names of the functions can be read back from the VM
+// code, so calls to them are checked by name only; classes already known (the bundled Jack OS
+// included) are kept as they are
+func (prg *Program) AddVMDeclarations(fileName string, src io.Reader) error {
+	classes := make(map[string]*classInfo)
+	scanner := bufio.NewScanner(src)
+	for scanner.Scan() {
+		// function Class.name nLocals
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 || fields[0] != "function" {
+			continue
+		}
+		className, name, ok := strings.Cut(fields[1], ".")
+		if !ok {
+			continue
+		}
+		if _, known := prg.index.classes[className]; known {
+			continue
+		}
+		cls, ok := classes[className]
+		if !ok {
+			cls = &classInfo{
+				name:        className,
+				fileName:    fileName,
+				subroutines: make(map[string]*subroutineInfo),
+				functions:   make(map[string]bool),
+			}
+			classes[className] = cls
+		}
+		cls.functions[name] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	for name, cls := range classes {
+		prg.index.classes[name] = cls
+	}
+	return nil
+}
+
+// LoadOSStubs adds the declarations of every jack file of the directory, overriding or extending
+// the bundled Jack OS API (for teams writing their own OS)
+func (prg *Program) LoadOSStubs(dir string) error {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.jack"))
+	if err != nil {
+		return err
+	}
+	if len(matches) == 0 {
+		return fmt.Errorf("no jack files found in %s", dir)
+	}
+	for _, match := range matches {
+		src, err := os.ReadFile(match)
+		if err != nil {
+			return err
+		}
+		prg.AddDeclarations(match, bytes.NewReader(src))
+	}
+	return nil
+}
+
+// Compile writes the VM code of a file added with AddFile, returning every diagnostic of the
+// file (use diag.List.Err to know if the compilation failed)
+func (prg *Program) Compile(fileName string, dstFile io.Writer) diag.List {
+	unit, ok := prg.units[fileName]
+	if !ok {
+		return diag.List{diag.Errorf("compiler", ast.Span{}, "file %s is not part of the program", fileName)}
+	}
+
+	diagnostics := append(diag.List{}, unit.diagnostics...)
+	if diagnostics.Err() != nil {
+		// the tree is incomplete
+		return diagnostics
+	}
+
+	checked := newTypeChecker(prg.typeCheck, prg.index).check(unit.class)
+	engine := newCompilationEngine(dstFile, prg.index)
+	engine.dropUnreachable = prg.dropUnreachable
+	engine.warnShadow = prg.warnShadow
+	engine.isDebugEnabled = prg.debug
+	compiled := append(checked, engine.compile(unit.class)...)
+	// the type checker and the engine each walk the whole class
+	compiled.Sort()
+	compiled.SetFile(fileName)
+	return append(diagnostics, compiled...)
+}
@@ -0,0 +1,435 @@
+package compiler
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// compileProgram compiles the files of a program (file name, source, ...) returning the diagnostics
+// of every file as file:line:column: title: message
+func compileProgram(level TypeCheckLevel, files ...string) []string {
+	prg := NewProgram().WithTypeCheck(level)
+	for i := 0; i < len(files); i += 2 {
+		prg.AddFile(files[i], strings.NewReader(files[i+1]))
+	}
+	var diagnostics []string
+	for i := 0; i < len(files); i += 2 {
+		for _, d := range prg.Compile(files[i], io.Discard) {
+			diagnostics = append(diagnostics, d.Error())
+		}
+	}
+	return diagnostics
+}
+
+// mainClass class Main with a single function main declaring vars and running body
+func mainClass(vars, body string) string {
+	return "class Main {\n    function void main() {\n" + vars + "\n" + body + "\n        return;\n    }\n}\n"
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		name  string
+		level TypeCheckLevel
+		files []string // file name, source, ...
+		want  []string
+	}{
+		// syntax errors and recovery
+		{
+			name: "recovers after a missing semicolon",
+			files: []string{"Main.jack", mainClass("        var int x;", `
+        let x = 1
+        let x = ;`)},
+			want: []string{
+				"Main.jack:5:18: syntax error: expected ';', got keyword 'let'",
+				"Main.jack:6:17: syntax error: expected parenthesis or unaryOp, got symbol ';'",
+			},
+		},
+		{
+			name:  "recovers at the next declaration",
+			files: []string{"Main.jack", "class Main {\n    field int x y;\n    static int z;\n    function void main() {\n        let z = ;\n        return;\n    }\n}\n"},
+			want: []string{
+				"Main.jack:2:16: syntax error: expected ';', got identifier 'y'",
+				"Main.jack:5:17: syntax error: expected parenthesis or unaryOp, got symbol ';'",
+			},
+		},
+		{
+			name:  "unexpected end of file",
+			files: []string{"Main.jack", "class Main {\n    function void main() {\n        return;\n"},
+			want:  []string{"Main.jack:4:1: syntax error: unexpected end of file, expected '}'"},
+		},
+		{
+			name:  "unterminated string",
+			files: []string{"Main.jack", mainClass("", `        do Output.printString("hello);`)},
+			want:  []string{"Main.jack:4:31: lexical error: newline in string constant"},
+		},
+		{
+			name:  "unterminated comment",
+			files: []string{"Main.jack", "class Main {\n    /* no end\n}\n"},
+			want:  []string{"Main.jack:2:5: lexical error: unterminated comment"},
+		},
+		{
+			name:  "not a Jack operator",
+			files: []string{"Main.jack", mainClass("        var boolean b;", "        let b = true && false;")},
+			want:  []string{"Main.jack:4:22: lexical error: '&&' is not a Jack operator"},
+		},
+		{
+			name:  "illegal character",
+			files: []string{"Main.jack", mainClass("        var int x;", "        let x = 1 # 2;")},
+			want:  []string{"Main.jack:4:19: lexical error: illegal character '#'"},
+		},
+		{
+			name:  "integer out of range",
+			files: []string{"Main.jack", mainClass("        var int x;", "        let x = 32768;\n        let x = -32768;")},
+			want:  []string{"Main.jack:4:17: syntax error: integer constant 32768 is out of range"},
+		},
+
+		// calls across the files of the program
+		{
+			name:  "unknown class",
+			files: []string{"Main.jack", mainClass("", "        do Foo.bar();")},
+			want:  []string{"Main.jack:4:12: compiler error: unknown class Foo"},
+		},
+		{
+			name:  "unknown class of a variable",
+			files: []string{"Main.jack", mainClass("        var Sqaure f;", "        let f = 0;\n        do f.bar(1, 2);")},
+			want:  []string{"Main.jack:5:12: compiler error: unknown class Sqaure"},
+		},
+		{
+			name:  "method of a primitive variable",
+			files: []string{"Main.jack", mainClass("        var int x;", "        let x = 1;\n        do x.length();")},
+			want:  []string{"Main.jack:5:12: compiler error: cannot call length on x (variable of type int)"},
+		},
+		{
+			name: "subroutine of another file",
+			files: []string{
+				"Main.jack", mainClass("        var Square s;", "        let s = Square.new(1);\n        do s.draw(2);\n        do s.dispose();"),
+				"Square.jack", "class Square {\n    field int size;\n    constructor Square new(int n) {\n        let size = n;\n        return this;\n    }\n    method void draw() {\n        return;\n    }\n}\n",
+			},
+			want: []string{
+				"Main.jack:5:12: compiler error: method Square.draw expects 0 arguments, got 1",
+				"Main.jack:6:14: compiler error: unknown subroutine Square.dispose",
+			},
+		},
+		{
+			name: "arity",
+			files: []string{"Main.jack", `class Main {
+    function void main() {
+        do Main.f(1, 2);
+        do Main.f();
+        do Main.f(3);
+        return;
+    }
+    function void f(int a) {
+        return;
+    }
+}
+`},
+			want: []string{
+				"Main.jack:3:12: compiler error: function Main.f expects 1 argument, got 2",
+				"Main.jack:4:12: compiler error: function Main.f expects 1 argument, got 0",
+				"Main.jack:8:25: warning: unused parameter a",
+			},
+		},
+		{
+			name:  "unknown subroutine of the Jack OS",
+			files: []string{"Main.jack", mainClass("", "        do Output.printx(1);")},
+			want:  []string{"Main.jack:4:19: compiler error: unknown subroutine Output.printx"},
+		},
+		{
+			name:  "arity of the Jack OS",
+			files: []string{"Main.jack", mainClass("", "        do Output.printInt(1, 2);")},
+			want:  []string{"Main.jack:4:12: compiler error: function Output.printInt expects 1 argument, got 2"},
+		},
+		{
+			name: "call kind",
+			files: []string{"Main.jack", `class Main {
+    field int x;
+    method void m() {
+        do Main.m();
+        do Main.f();
+        return;
+    }
+    function void f() {
+        var Main main;
+        do m();
+        let main = Main.f();
+        do main.f();
+        return;
+    }
+}
+`},
+			want: []string{
+				"Main.jack:2:15: warning: unused field x",
+				"Main.jack:4:12: compiler error: cannot call method Main.m on class Main",
+				"Main.jack:10:12: compiler error: cannot call method Main.m without an object",
+				"Main.jack:12:12: compiler error: cannot call function Main.f through an instance",
+			},
+		},
+		{
+			name: "field in a function",
+			files: []string{"Main.jack", `class Main {
+    field int x;
+    function int f() {
+        return x;
+    }
+    function Main g() {
+        return this;
+    }
+}
+`},
+			want: []string{
+				"Main.jack:4:16: compiler error: cannot use field x in a function",
+				"Main.jack:7:16: compiler error: cannot use this in a function",
+			},
+		},
+
+		// control flow
+		{
+			name: "missing return",
+			files: []string{"Main.jack", `class Main {
+    function int f(boolean b) {
+        if (b) {
+            return 1;
+        }
+    }
+    function void g() {
+        return 1;
+    }
+    function int h() {
+        return;
+    }
+    function int loop() {
+        while (true) {
+        }
+    }
+}
+`},
+			want: []string{
+				"Main.jack:6:5: compiler error: missing return at the end of Main.f",
+				"Main.jack:8:16: compiler error: void subroutine Main.g cannot return a value",
+				"Main.jack:11:9: compiler error: missing return value, Main.h returns int",
+			},
+		},
+		{
+			name: "unreachable code",
+			files: []string{"Main.jack", `class Main {
+    function int f(boolean b) {
+        if (b) {
+            return 1;
+        } else {
+            return 2;
+        }
+        return 3;
+    }
+    function int g() {
+        while (true) {
+            do Output.printInt(1);
+        }
+        return 0;
+    }
+}
+`},
+			want: []string{"Main.jack:8:9: warning: unreachable statement"},
+		},
+
+		// variables
+		{
+			name:  "unused variables",
+			files: []string{"Main.jack", mainClass("        var int x, y;\n        var int z; // jack:unused", "        let x = 1;\n        do Output.printInt(x);")},
+			want:  []string{"Main.jack:3:20: warning: unused variable y"},
+		},
+		{
+			name:  "used before being assigned",
+			files: []string{"Main.jack", mainClass("        var int sum, i;", "        if (i < 0) {\n            let sum = 1;\n        }\n        do Output.printInt(sum);")},
+			want: []string{
+				"Main.jack:4:13: warning: i is used before being assigned",
+				"Main.jack:7:28: warning: sum may be used before being assigned",
+			},
+		},
+		{
+			name:  "used before being assigned in a loop",
+			files: []string{"Main.jack", mainClass("        var int i, last;", "        let i = 0;\n        while (i < 3) {\n            do Output.printInt(last);\n            let last = i;\n            let i = i + 1;\n        }")},
+			want:  []string{"Main.jack:6:32: warning: last may be used before being assigned"},
+		},
+		{
+			name:  "unused variable declared twice",
+			files: []string{"Main.jack", mainClass("        var int x, y, x;", "        let y = 1;\n        do Output.printInt(y);")},
+			want: []string{
+				"Main.jack:3:17: warning: unused variable x",
+				"Main.jack:3:23: compiler error: x is already declared",
+			},
+		},
+		{
+			name:  "declared twice",
+			files: []string{"Main.jack", mainClass("        var int x, y, x;", "        let x = 1;\n        let y = x;\n        do Output.printInt(y);")},
+			want:  []string{"Main.jack:3:23: compiler error: x is already declared"},
+		},
+		{
+			name: "class declared twice",
+			files: []string{
+				"Main.jack", mainClass("", ""),
+				"Other.jack", "class Main {\n}\n",
+			},
+			want: []string{
+				"Other.jack:1:7: compiler error: class Main is already declared",
+				"Other.jack:1:7: compiler error: class Main is declared in Other.jack",
+			},
+		},
+		{
+			name:  "class name and file name",
+			files: []string{"src/Game.jack", "class Main {\n}\n"},
+			want:  []string{"src/Game.jack:1:7: compiler error: class Main is declared in Game.jack"},
+		},
+
+		// type checker
+		{
+			name:  "type check off",
+			files: []string{"Main.jack", mainClass("        var boolean b;\n        var int x;", "        let b = 1;\n        let x = \"one\";\n        do Output.printInt(x);\n        do Output.printInt(b);")},
+		},
+		{
+			name:  "type check loose",
+			level: TypeCheckLoose,
+			files: []string{"Main.jack", mainClass("        var boolean b;\n        var int x;", "        let b = 1;\n        let x = \"one\";\n        do x.length();\n        do Output.printInt(b);")},
+			want: []string{
+				"Main.jack:5:17: type error: cannot assign a value of type int to b (variable of type boolean)",
+				"Main.jack:7:12: compiler error: cannot call length on x (variable of type int)",
+				"Main.jack:8:28: type error: cannot use a value of type boolean as argument i (int) of Output.printInt",
+			},
+		},
+		{
+			name:  "type error after a compiler error",
+			level: TypeCheckLoose,
+			files: []string{"Main.jack", mainClass("        var boolean b;", "        do Main.draw();\n        let b = 1;\n        do Output.printInt(b);")},
+			want: []string{
+				"Main.jack:4:17: compiler error: unknown subroutine Main.draw",
+				"Main.jack:5:17: type error: cannot assign a value of type int to b (variable of type boolean)",
+				"Main.jack:6:28: type error: cannot use a value of type boolean as argument i (int) of Output.printInt",
+			},
+		},
+		{
+			name:  "type check strict",
+			level: TypeCheckStrict,
+			files: []string{"Main.jack", mainClass("        var boolean b;\n        var int x;", "        let b = 1;\n        let x = \"one\";\n        do Output.printInt(x);")},
+			want: []string{
+				"Main.jack:3:21: warning: variable b is assigned but never read",
+				"Main.jack:5:17: type error: cannot assign a value of type int to b (variable of type boolean)",
+				"Main.jack:6:17: type error: cannot assign a value of type String to x (variable of type int)",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := compileProgram(test.level, test.files...)
+			if !slices.Equal(got, test.want) {
+				t.Errorf("got diagnostics\n\t%s\nwant\n\t%s", strings.Join(got, "\n\t"), strings.Join(test.want, "\n\t"))
+			}
+		})
+	}
+}
+
+func TestDropUnreachable(t *testing.T) {
+	src := `class Main {
+    function int f() {
+        return 1;
+        return 2;
+    }
+    function int g() {
+        while (true) {
+        }
+        return 0;
+    }
+}
+`
+	var vm strings.Builder
+	prg := NewProgram().WithDropUnreachable(true)
+	prg.AddFile("Main.jack", strings.NewReader(src))
+	prg.Compile("Main.jack", &vm)
+
+	// the return following the loop is not reported, so it is kept
+	want := "function Main.f 0\n\tpush constant 1\n\treturn\n" +
+		"function Main.g 0\nlabel Main_0\n\tpush constant 1\n\tneg\n\tnot\n\tif-goto Main_1\n\tgoto Main_0\nlabel Main_1\n" +
+		"\tpush constant 0\n\treturn\n"
+	if got := vm.String(); got != want {
+		t.Errorf("got VM code\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestShadowWarnings(t *testing.T) {
+	src := `class Main {
+    field int x; // jack:unused
+    method void m(int x) {
+        var int y;
+        let y = x;
+        do Output.printInt(y);
+        return;
+    }
+}
+`
+	for _, enabled := range []bool{false, true} {
+		prg := NewProgram().WithShadowWarnings(enabled)
+		prg.AddFile("Main.jack", strings.NewReader(src))
+		var got []string
+		for _, d := range prg.Compile("Main.jack", io.Discard) {
+			got = append(got, d.Error())
+		}
+		var want []string
+		if enabled {
+			want = []string{"Main.jack:3:23: warning: parameter x shadows field x"}
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("shadow warnings %v: got diagnostics\n\t%s\nwant\n\t%s", enabled, strings.Join(got, "\n\t"), strings.Join(want, "\n\t"))
+		}
+	}
+}
+
+func TestAddVMDeclarations(t *testing.T) {
+	prg := NewProgram()
+	vm := "function Helper.twice 0\npush argument 0\npush argument 0\nadd\nreturn\nfunction Math.cube 0\npush constant 0\nreturn\n"
+	if err := prg.AddVMDeclarations("Helper.vm", strings.NewReader(vm)); err != nil {
+		t.Fatal(err)
+	}
+	prg.AddFile("Main.jack", strings.NewReader(mainClass("        var Helper h;",
+		"        do Output.printInt(Helper.twice(1, 2));\n        do Helper.thrice();\n        let h = 0;\n        do h.twice();\n        do Math.cube(2);")))
+	var got []string
+	for _, d := range prg.Compile("Main.jack", io.Discard) {
+		got = append(got, d.Error())
+	}
+	// the arity of Helper.twice is unknown, Math stays the one of the Jack OS
+	want := []string{
+		"Main.jack:5:19: compiler error: unknown subroutine Helper.thrice",
+		"Main.jack:8:17: compiler error: unknown subroutine Math.cube",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got diagnostics\n\t%s\nwant\n\t%s", strings.Join(got, "\n\t"), strings.Join(want, "\n\t"))
+	}
+}
+
+func TestLoadOSStubs(t *testing.T) {
+	dir := t.TempDir()
+	stub := "class Output {\n    function void printInt(int i, int base) {\n        return;\n    }\n    function void printHex(int i) {\n        return;\n    }\n}\n"
+	if err := os.WriteFile(filepath.Join(dir, "Output.jack"), []byte(stub), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	prg := NewProgram()
+	if err := prg.LoadOSStubs(dir); err != nil {
+		t.Fatal(err)
+	}
+	// the stub replaces printInt and adds printHex, the other subroutines of Output are kept
+	prg.AddFile("Main.jack", strings.NewReader(mainClass("",
+		"        do Output.printInt(1, 2);\n        do Output.printHex(255);\n        do Output.println();\n        do Output.printInt(1);\n        do Output.printf();")))
+	var got []string
+	for _, d := range prg.Compile("Main.jack", io.Discard) {
+		got = append(got, d.Error())
+	}
+	want := []string{
+		"Main.jack:7:12: compiler error: function Output.printInt expects 2 arguments, got 1",
+		"Main.jack:8:19: compiler error: unknown subroutine Output.printf",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got diagnostics\n\t%s\nwant\n\t%s", strings.Join(got, "\n\t"), strings.Join(want, "\n\t"))
+	}
+}
@@ -1,12 +1,19 @@
 package compiler
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/Dudssource/dd-jack-compiler/compiler/ast"
+)
 
 type tableItem struct {
 	name     string
 	ttype    string
 	kind     string
 	position int
+	reads    int
+	writes   int
+	span     ast.Span // name in the declaration
 }
 
 type table struct {
@@ -91,6 +98,28 @@ func (s *symbolTable) find(name string) (tableItem, bool) {
 	return tableItem{}, false
 }
 
+// markRead records a read of the variable, for the unused variables warnings
+func (s *symbolTable) markRead(name string) {
+	s.update(name, func(item *tableItem) { item.reads++ })
+}
+
+// markWrite records an assignment of the variable
+func (s *symbolTable) markWrite(name string) {
+	s.update(name, func(item *tableItem) { item.writes++ })
+}
+
+func (s *symbolTable) update(name string, f func(item *tableItem)) {
+	cnt := s.currentTbl
+	for cnt >= 0 {
+		if item, ok := s.tbl[cnt].items[name]; ok {
+			f(&item)
+			s.tbl[cnt].items[name] = item
+			return
+		}
+		cnt--
+	}
+}
+
 func (s *symbolTable) next() {
 	s.currentTbl++
 	// reset before use
@@ -107,14 +136,27 @@ func (s *symbolTable) prev() {
 }
 
 func (s *symbolTable) define(name, ttype, kind string) {
+	s.declare(name, ttype, kind, ast.Span{})
+}
+
+// declare adds a symbol declared at span to the current level, when the level already declares the
+// name the existing symbol is kept and returned along with false: the first declaration wins, so the
+// code using the name compiles consistently while the duplicate is reported by the compilation engine
+func (s *symbolTable) declare(name, ttype, kind string, span ast.Span) (tableItem, bool) {
 	if kind == "field" {
 		kind = "this"
 	}
-	s.tbl[s.currentTbl].items[name] = tableItem{
+	if item, ok := s.tbl[s.currentTbl].items[name]; ok {
+		return item, false
+	}
+	item := tableItem{
 		name:     name,
 		ttype:    ttype,
 		kind:     kind,
 		position: s.tbl[s.currentTbl].segmentCounter[kind],
+		span:     span,
 	}
+	s.tbl[s.currentTbl].items[name] = item
 	s.tbl[s.currentTbl].segmentCounter[kind]++
+	return item, true
 }
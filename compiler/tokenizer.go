@@ -6,8 +6,12 @@ import (
 	"fmt"
 	"io"
 	"regexp"
+	"strconv"
 	"strings"
 	"unicode"
+
+	"github.com/Dudssource/dd-jack-compiler/compiler/ast"
+	"github.com/Dudssource/dd-jack-compiler/compiler/diag"
 )
 
 type TokenType string
@@ -22,63 +26,107 @@ const (
 	IntConst    TokenType = "integerConstant"
 	StringConst TokenType = "stringConstant"
 	Identifier  TokenType = "identifier"
+	// EOF sentinel token returned once the source is exhausted
+	EOF TokenType = "eof"
+	// Illegal character that is not part of the language, reported as a lexical error
+	Illegal TokenType = "illegal"
 )
 
+// maxIntConst largest integer constant of the Hack platform (16 bits two's complement), the
+// smallest value (-32768) can only be written as the negation of 32768
+const maxIntConst = 32767
+
 var (
 	keywordRegex    = regexp.MustCompile(`^(class|constructor|function|field|method|static|var|int|char|boolean|void|true|false|null|this|let|do|if|else|while|return)$`)
 	identifierRegex = regexp.MustCompile(`^[a-zA-Z0-9_]{1}$`)
 )
 
 type Token struct {
-	lex    TokenType
-	value  string
-	lineNo int
+	lex     TokenType
+	value   string
+	span    ast.Span
+	invalid bool // a lexical error was reported for the token
 }
 
 func (t *Token) String() string {
-	return fmt.Sprintf("lex=%s, value=%s, lineNo=%d", t.lex, t.value, t.lineNo)
+	return fmt.Sprintf("lex=%s, value=%s, span=%s", t.lex, t.value, t.span)
 }
 
-func newToken(symbol TokenType, value string, lineNo int) *Token {
-	return &Token{lex: symbol, lineNo: lineNo, value: value}
+// describe human readable description of the token, used by diagnostics
+func (t *Token) describe() string {
+	if t.lex == EOF {
+		return "end of file"
+	}
+	if t.lex == StringConst {
+		return fmt.Sprintf("%s \"%s\"", t.lex, t.value)
+	}
+	return fmt.Sprintf("%s '%s'", t.lex, t.value)
+}
+
+// pos position of the first character of the token
+func (t *Token) pos() ast.Pos {
+	return t.span.Start
+}
+
+func newToken(symbol TokenType, value string, start, end ast.Pos) *Token {
+	return &Token{lex: symbol, value: value, span: ast.Span{Start: start, End: end}}
 }
 
 type jackTokenizer struct {
 	reader       *bufio.Reader
-	lineNo       int
+	position     ast.Pos // position of the next character
+	lastPosition ast.Pos // position of the last character read, restored by rewind
 	more         bool
 	currentToken *Token
+	diagnostics  diag.List
+	truncated    bool // an unterminated comment or string consumed the rest of the file
+	comments     []*ast.Comment
 }
 
 func newTokenizer(srcFile io.Reader) *jackTokenizer {
 	return &jackTokenizer{
-		lineNo: 1,
-		reader: bufio.NewReader(srcFile),
+		position: ast.Pos{Line: 1, Column: 1},
+		reader:   bufio.NewReader(srcFile),
 	}
 }
 
 // readChar low level function to read the next character on the stream of characters
 func (tkn *jackTokenizer) readChar() (rune, bool) {
 	// current char
-	ch, _, err := tkn.reader.ReadRune()
+	ch, size, err := tkn.reader.ReadRune()
 	if err != nil {
 		if errors.Is(err, io.EOF) {
 			return unicode.MaxRune, false
 		}
 		panic(err)
 	}
+	tkn.lastPosition = tkn.position
+	tkn.position.Offset += size
 	if ch == '\n' {
-		tkn.lineNo++
+		tkn.position.Line++
+		tkn.position.Column = 1
+	} else {
+		tkn.position.Column++
 	}
 	return ch, true
 }
 
-// rewind low level function to rewind the stream of characters (not the token)
+// errorf reports a lexical error
+func (tkn *jackTokenizer) errorf(span ast.Span, format string, args ...any) *diag.Diagnostic {
+	d := diag.Errorf("lexical", span, format, args...)
+	tkn.diagnostics = append(tkn.diagnostics, d)
+	return d
+}
+
+// rewind low level function to rewind the stream of characters (not the token), only the last
+// character read can be rewound
 func (tkn *jackTokenizer) rewind() {
-	_ = tkn.reader.UnreadRune()
+	if err := tkn.reader.UnreadRune(); err == nil {
+		tkn.position = tkn.lastPosition
+	}
 }
 
-// token returns the current token or nil
+// token returns the current token, an EOF token once the source is exhausted
 func (tkn *jackTokenizer) token() *Token {
 	return tkn.currentToken
 }
@@ -91,6 +139,14 @@ func (tkn *jackTokenizer) hasMoreTokens() bool {
 // advance advances the tokenizer
 func (tkn *jackTokenizer) advance() {
 	tkn.currentToken, tkn.more = tkn.getNextToken()
+	// illegal characters were already reported, the parser never sees them
+	for tkn.currentToken != nil && tkn.currentToken.lex == Illegal {
+		tkn.currentToken, tkn.more = tkn.getNextToken()
+	}
+	if tkn.currentToken == nil {
+		// keep a sentinel so the parser never sees a nil token
+		tkn.currentToken = newToken(EOF, "", tkn.position, tkn.position)
+	}
 }
 
 // getNextToken low level access to token and next
@@ -98,47 +154,83 @@ func (tkn *jackTokenizer) getNextToken() (*Token, bool) {
 
 	for ch, hasNext := tkn.readChar(); hasNext; ch, hasNext = tkn.readChar() {
 
+		// first character of the token
+		start := tkn.lastPosition
+
 		switch ch {
 
 		case '/': // symbol / or comment // or multi-line comment /* */
-			if sch, hasNext := tkn.readChar(); hasNext {
-				if sch == '/' { // is a comment, ignore the rest of line
-					for sch, hasNext := tkn.readChar(); hasNext; sch, hasNext = tkn.readChar() {
-						if sch == '\n' || sch == '\r' {
-							// rewind
-							tkn.rewind()
-							break
-						}
+			sch, hasNext := tkn.readChar()
+			if !hasNext {
+				// symbol at the end of the file
+				return newToken(Symbol, string(ch), start, tkn.position), true
+			}
+			if sch == '/' { // is a comment, ignore the rest of line
+				var sb strings.Builder
+				sb.WriteString("//")
+				for sch, hasNext := tkn.readChar(); hasNext; sch, hasNext = tkn.readChar() {
+					if sch == '\n' || sch == '\r' {
+						// rewind
+						tkn.rewind()
+						break
 					}
-					continue
+					sb.WriteRune(sch)
 				}
-				multiLine := false
-				if sch == '*' {
-					multiLine = true
-					lastChar := false
-					for sch, hasNext := tkn.readChar(); hasNext; sch, hasNext = tkn.readChar() {
-						if lastChar && sch == '/' {
-							break
-						}
-						if sch == '*' {
-							lastChar = true
-						} else {
-							lastChar = false
-						}
+				tkn.comment(sb.String(), start)
+				continue
+			}
+			if sch == '*' {
+				var sb strings.Builder
+				sb.WriteString("/*")
+				closed := false
+				lastChar := false
+				for sch, hasNext := tkn.readChar(); hasNext; sch, hasNext = tkn.readChar() {
+					sb.WriteRune(sch)
+					if lastChar && sch == '/' {
+						closed = true
+						break
+					}
+					if sch == '*' {
+						lastChar = true
+					} else {
+						lastChar = false
 					}
 				}
+				tkn.comment(sb.String(), start)
+				if !closed {
+					tkn.truncated = true
+					tkn.errorf(ast.Span{Start: start, End: start.Shift("/*")}, "unterminated comment").
+						WithHelp("close the comment with '*/'")
+				}
 				// skip everything up here
-				if multiLine {
-					continue
+				continue
+			}
+			// rewind
+			tkn.rewind()
+			// is symbol
+			return newToken(Symbol, string(ch), start, tkn.position), true
+
+		case '&', '|', '=': // symbols often doubled by mistake (&&, ||, ==)
+			if sch, hasNext := tkn.readChar(); hasNext && sch == ch {
+				token := newToken(Symbol, string(ch), start, tkn.position)
+				token.invalid = true
+				d := tkn.errorf(token.span, "'%c%c' is not a Jack operator", ch, ch)
+				if ch == '=' {
+					d.WithHelp("use '=' to compare values, assignments are made with 'let'")
+				} else {
+					d.WithHelp("use '%c', Jack has no short-circuit operators", ch)
 				}
-				// rewind
+				return token, true
+			} else if hasNext {
 				tkn.rewind()
-				// is symbol
-				return newToken(Symbol, string(ch), tkn.lineNo), true
 			}
+			return newToken(Symbol, string(ch), start, tkn.position), true
+
+		case '{', '}', '[', ']', '(', ')', ',', '.', ';', '+', '*', '-', '<', '>', '~': // symbols (except /)
+			return newToken(Symbol, string(ch), start, tkn.position), true
 
-		case '{', '}', '[', ']', '(', ')', ',', '.', ';', '+', '*', '-', '&', '|', '<', '>', '=', '~': // symbols (except /)
-			return newToken(Symbol, string(ch), tkn.lineNo), true
+		case '\'': // character literals don't exist in jack
+			return tkn.charLiteral(start), true
 
 		case '\n', '\r': // line break
 			continue
@@ -149,17 +241,32 @@ func (tkn *jackTokenizer) getNextToken() (*Token, bool) {
 			for sch, hasNext := tkn.readChar(); hasNext; sch, hasNext = tkn.readChar() {
 				// end of string
 				if sch == '"' {
-					return newToken(StringConst, sb.String(), tkn.lineNo), true
+					return newToken(StringConst, sb.String(), start, tkn.position), true
+				}
+				// string constants can't span lines, keep what was read so the parser can continue
+				if sch == '\n' || sch == '\r' {
+					tkn.rewind()
+					tkn.errorf(ast.Span{Start: start, End: tkn.position}, "newline in string constant").
+						WithHelp("close the string with '\"' before the end of the line")
+					token := newToken(StringConst, sb.String(), start, tkn.position)
+					token.invalid = true
+					return token, true
 				}
 				sb.WriteRune(sch)
 			}
+			tkn.truncated = true
+			tkn.errorf(ast.Span{Start: start, End: tkn.position}, "unterminated string constant").
+				WithHelp("close the string with '\"'")
+			token := newToken(StringConst, sb.String(), start, tkn.position)
+			token.invalid = true
+			return token, true
 
 		case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9': // integer constant
 			var sb strings.Builder
 			sb.WriteRune(ch)
 			// read while digit
 			for sch, hasNext := tkn.readChar(); hasNext; sch, hasNext = tkn.readChar() {
-				if unicode.IsDigit(sch) {
+				if sch >= '0' && sch <= '9' {
 					sb.WriteRune(sch)
 				} else {
 					// rewind
@@ -167,7 +274,13 @@ func (tkn *jackTokenizer) getNextToken() (*Token, bool) {
 					break
 				}
 			}
-			return newToken(IntConst, sb.String(), tkn.lineNo), true
+			token := newToken(IntConst, sb.String(), start, tkn.position)
+			if _, err := strconv.Atoi(token.value); err != nil {
+				token.invalid = true
+				tkn.errorf(token.span, "integer constant is too large").
+					WithHelp("integer constants must be between 0 and %d", maxIntConst)
+			}
+			return token, true
 
 		default:
 
@@ -176,14 +289,14 @@ func (tkn *jackTokenizer) getNextToken() (*Token, bool) {
 				continue
 			}
 
-			// identifier or keyword
-			if identifierRegex.MatchString(string(ch)) {
+			// identifier or keyword, non ASCII letters are read as well so the identifier is reported as a whole
+			if identifierRegex.MatchString(string(ch)) || unicode.IsLetter(ch) {
 
 				var sb strings.Builder
 				sb.WriteRune(ch)
 				// read while letter or _ or digit
 				for sch, hasNext := tkn.readChar(); hasNext; sch, hasNext = tkn.readChar() {
-					if identifierRegex.MatchString(string(sch)) {
+					if identifierRegex.MatchString(string(sch)) || unicode.IsLetter(sch) {
 						sb.WriteRune(sch)
 					} else {
 						// rewind
@@ -192,17 +305,106 @@ func (tkn *jackTokenizer) getNextToken() (*Token, bool) {
 					}
 				}
 
-				token := newToken(Identifier, sb.String(), tkn.lineNo)
+				token := newToken(Identifier, sb.String(), start, tkn.position)
 
 				// check for keyword
 				if keywordRegex.MatchString(token.value) {
 					token.lex = Keyword
 				}
 
+				if !isASCII(token.value) {
+					token.invalid = true
+					tkn.errorf(token.span, "illegal character in identifier '%s'", token.value).
+						WithHelp("identifiers may only contain ASCII letters, digits and '_'")
+				}
+
 				return token, true
 			}
+
+			// anything else is not part of the language
+			return tkn.illegal(ch, start), true
 		}
 	}
 
 	return nil, false
 }
+
+// comment records a comment, ending at the current position
+func (tkn *jackTokenizer) comment(text string, start ast.Pos) {
+	// the current token is still the one preceding the comment
+	trailing := tkn.currentToken != nil && tkn.currentToken.span.End.Line == start.Line
+	tkn.comments = append(tkn.comments, &ast.Comment{Slash: start, Text: text, EndPos: tkn.position, Trailing: trailing})
+}
+
+// illegal reports a character that is not part of the language, with hints for the usual mistakes
+func (tkn *jackTokenizer) illegal(ch rune, start ast.Pos) *Token {
+	value := string(ch)
+	help := ""
+
+	switch ch {
+	case '!':
+		if sch, hasNext := tkn.readChar(); hasNext && sch == '=' {
+			value = "!="
+			help = "Jack has no '!=' operator, use ~(a = b)"
+		} else {
+			if hasNext {
+				tkn.rewind()
+			}
+			help = "use '~' for the logical not"
+		}
+	case '%':
+		help = "Jack has no modulo operator, compute it with a - ((a / b) * b)"
+	}
+
+	token := newToken(Illegal, value, start, tkn.position)
+	token.invalid = true
+	d := tkn.errorf(token.span, "illegal character %q", ch)
+	if value != string(ch) {
+		d.Message = fmt.Sprintf("illegal operator '%s'", value)
+	}
+	if help != "" {
+		d.WithHelp("%s", help)
+	}
+	return token
+}
+
+// charLiteral reports a single quoted character, which is replaced by its code so the parser can continue
+func (tkn *jackTokenizer) charLiteral(start ast.Pos) *Token {
+	var sb strings.Builder
+	closed := false
+	for sch, hasNext := tkn.readChar(); hasNext; sch, hasNext = tkn.readChar() {
+		if sch == '\'' {
+			closed = true
+			break
+		}
+		if sch == '\n' || sch == '\r' {
+			tkn.rewind()
+			break
+		}
+		sb.WriteRune(sch)
+	}
+
+	value := []rune(sb.String())
+	if !closed || len(value) != 1 {
+		token := newToken(Illegal, "'"+sb.String(), start, tkn.position)
+		token.invalid = true
+		tkn.errorf(token.span, "illegal character '\\''").
+			WithHelp("string constants are delimited by double quotes")
+		return token
+	}
+
+	token := newToken(IntConst, strconv.Itoa(int(value[0])), start, tkn.position)
+	token.invalid = true
+	tkn.errorf(token.span, "Jack has no character literals").
+		WithHelp("use the character code instead, %d for '%c'", value[0], value[0])
+	return token
+}
+
+func isASCII(value string) bool {
+	for _, ch := range value {
+		if ch > unicode.MaxASCII {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,342 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/Dudssource/dd-jack-compiler/compiler/ast"
+	"github.com/Dudssource/dd-jack-compiler/compiler/diag"
+)
+
+// TypeCheckLevel strictness of the type checker, Jack is loosely typed by design so the checker is optional
+type TypeCheckLevel int
+
+const (
+	// TypeCheckOff disables the type checker
+	TypeCheckOff TypeCheckLevel = iota
+	// TypeCheckLoose reports what is almost always a bug: booleans mixed with numbers or objects,
+	// methods called on int, char or boolean variables, unknown classes used as types and values
+	// of void subroutines
+	TypeCheckLoose
+	// TypeCheckStrict also requires matching types: numbers and objects can't be mixed, nor objects
+	// of different classes (except Array and null), conditions must be boolean and operators need
+	// operands of the proper type; int and char stay interchangeable as Jack has no char literals
+	TypeCheckStrict
+)
+
+var typeCheckLevels = []string{"off", "loose", "strict"}
+
+func (l TypeCheckLevel) String() string {
+	if int(l) < len(typeCheckLevels) {
+		return typeCheckLevels[l]
+	}
+	return "unknown"
+}
+
+// ParseTypeCheckLevel parses off, loose or strict
+func ParseTypeCheckLevel(level string) (TypeCheckLevel, error) {
+	for i, name := range typeCheckLevels {
+		if name == level {
+			return TypeCheckLevel(i), nil
+		}
+	}
+	return TypeCheckOff, fmt.Errorf("unknown type check level %s, expected off, loose or strict", level)
+}
+
+const (
+	// nullType type of the null constant, compatible with every object
+	nullType = "null"
+	// anyType type that couldn't be inferred (e.g. array elements), compatible with everything
+	anyType = ""
+)
+
+// typeChecker infers the type of every expression of a class, reporting incompatible assignments,
+// arguments and return values
+type typeChecker struct {
+	level       TypeCheckLevel
+	index       *programIndex
+	symbolTable *symbolTable
+	className   string
+	returnType  string
+	diagnostics diag.List
+}
+
+func newTypeChecker(level TypeCheckLevel, index *programIndex) *typeChecker {
+	return &typeChecker{
+		level:       level,
+		index:       index,
+		symbolTable: newSymbolTable(),
+	}
+}
+
+func (tc *typeChecker) check(class *ast.Class) diag.List {
+	if tc.level == TypeCheckOff {
+		return nil
+	}
+
+	tc.className = class.Name.Name
+	for _, dec := range class.Vars {
+		tc.checkType(dec.Type)
+		for _, name := range dec.Names {
+			tc.symbolTable.define(name.Name, dec.Type.Name, dec.Kind)
+		}
+	}
+
+	for _, dec := range class.Subroutines {
+		tc.symbolTable.next()
+
+		if dec.Kind == "method" {
+			tc.symbolTable.define("this", tc.className, "argument")
+		}
+		tc.checkType(dec.ReturnType)
+		tc.returnType = dec.ReturnType.Name
+		for _, param := range dec.Params {
+			tc.checkType(param.Type)
+			tc.symbolTable.define(param.Name.Name, param.Type.Name, "argument")
+		}
+		for _, varDec := range dec.Body.Vars {
+			tc.checkType(varDec.Type)
+			for _, name := range varDec.Names {
+				tc.symbolTable.define(name.Name, varDec.Type.Name, "local")
+			}
+		}
+		tc.checkStatements(dec.Body.Statements)
+
+		tc.symbolTable.prev()
+	}
+
+	return tc.diagnostics
+}
+
+// checkType reports class types that no file of the program declares
+func (tc *typeChecker) checkType(ttype *ast.Ident) {
+	if ttype.IsPrimitive() || !tc.index.closed {
+		return
+	}
+	if _, ok := tc.index.classes[ttype.Name]; !ok {
+		tc.errorf(ast.SpanOf(ttype), "unknown type %s", ttype.Name).
+			WithHelp("types are int, char, boolean or the name of a class of the program")
+	}
+}
+
+func (tc *typeChecker) checkStatements(stmts []ast.Stmt) {
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *ast.LetStmt:
+			valueType := tc.typeOf(s.Value)
+			if s.Index != nil {
+				tc.checkIndex(s.Name, s.Index)
+				continue
+			}
+			if item, ok := tc.symbolTable.find(s.Name.Name); ok && !tc.assignable(item.ttype, valueType) {
+				tc.errorf(ast.SpanOf(s.Value), "cannot assign %s to %s (variable of type %s)",
+					describeType(valueType), s.Name.Name, item.ttype)
+			}
+		case *ast.IfStmt:
+			tc.checkCondition(s.Cond)
+			tc.checkStatements(s.Then)
+			tc.checkStatements(s.Else)
+		case *ast.WhileStmt:
+			tc.checkCondition(s.Cond)
+			tc.checkStatements(s.Body)
+		case *ast.DoStmt:
+			tc.typeOf(s.Call)
+		case *ast.ReturnStmt:
+			if s.Value == nil {
+				continue
+			}
+			valueType := tc.typeOf(s.Value)
+			if tc.returnType != "void" && !tc.assignable(tc.returnType, valueType) {
+				tc.errorf(ast.SpanOf(s.Value), "cannot return %s from a subroutine returning %s",
+					describeType(valueType), tc.returnType)
+			}
+		}
+	}
+}
+
+func (tc *typeChecker) checkCondition(cond ast.Expr) {
+	condType := tc.typeOf(cond)
+	if tc.level == TypeCheckStrict && condType != anyType && condType != "boolean" {
+		tc.errorf(ast.SpanOf(cond), "condition is %s, expected boolean", describeType(condType))
+	}
+}
+
+func (tc *typeChecker) checkIndex(name *ast.Ident, index ast.Expr) {
+	indexType := tc.typeOf(index)
+	if tc.level != TypeCheckStrict {
+		return
+	}
+	if item, ok := tc.symbolTable.find(name.Name); ok && item.ttype != "Array" {
+		tc.errorf(ast.SpanOf(name), "cannot index %s (variable of type %s)", name.Name, item.ttype).
+			WithHelp("only Array variables can be indexed")
+	}
+	if !tc.assignable("int", indexType) {
+		tc.errorf(ast.SpanOf(index), "array index is %s, expected int", describeType(indexType))
+	}
+}
+
+// typeOf infers the type of an expression, checking its operands and calls
+func (tc *typeChecker) typeOf(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.IntLit:
+		return "int"
+	case *ast.StringLit:
+		return "String"
+	case *ast.KeywordLit:
+		switch e.Value {
+		case "true", "false":
+			return "boolean"
+		case "null":
+			return nullType
+		case "this":
+			return tc.className
+		}
+	case *ast.VarRef:
+		if item, ok := tc.symbolTable.find(e.Name.Name); ok {
+			return item.ttype
+		}
+	case *ast.IndexExpr:
+		tc.checkIndex(e.Name, e.Index)
+		// array elements are untyped
+		return anyType
+	case *ast.ParenExpr:
+		return tc.typeOf(e.X)
+	case *ast.UnaryExpr:
+		operandType := tc.typeOf(e.X)
+		if e.Op == "-" {
+			tc.checkOperand(e.Op, e.X, operandType, "int")
+			return "int"
+		}
+		// ~ is logical for booleans and bitwise for numbers
+		if operandType == "boolean" {
+			return "boolean"
+		}
+		tc.checkOperand(e.Op, e.X, operandType, "int")
+		return "int"
+	case *ast.BinaryExpr:
+		return tc.typeOfBinary(e)
+	case *ast.CallExpr:
+		return tc.typeOfCall(e)
+	}
+	return anyType
+}
+
+func (tc *typeChecker) typeOfBinary(e *ast.BinaryExpr) string {
+	xType, yType := tc.typeOf(e.X), tc.typeOf(e.Y)
+	switch e.Op {
+	case "+", "-", "*", "/":
+		tc.checkOperand(e.Op, e.X, xType, "int")
+		tc.checkOperand(e.Op, e.Y, yType, "int")
+		return "int"
+	case "<", ">":
+		tc.checkOperand(e.Op, e.X, xType, "int")
+		tc.checkOperand(e.Op, e.Y, yType, "int")
+		return "boolean"
+	case "=":
+		if tc.level == TypeCheckStrict && !tc.assignable(xType, yType) && !tc.assignable(yType, xType) {
+			tc.errorf(ast.SpanOf(e), "cannot compare %s with %s", describeType(xType), describeType(yType))
+		}
+		return "boolean"
+	default: // & |
+		if xType == "boolean" && yType == "boolean" {
+			return "boolean"
+		}
+		if xType == anyType || yType == anyType {
+			return anyType
+		}
+		if tc.level == TypeCheckStrict && (xType == "boolean" || yType == "boolean") {
+			tc.errorf(ast.SpanOf(e), "operator %s mixes %s with %s", e.Op, describeType(xType), describeType(yType))
+		}
+		return "int"
+	}
+}
+
+// checkOperand requires a numeric operand in strict mode
+func (tc *typeChecker) checkOperand(op string, operand ast.Expr, operandType, expected string) {
+	if tc.level == TypeCheckStrict && !tc.assignable(expected, operandType) {
+		tc.errorf(ast.SpanOf(operand), "operator %s expects %s, got %s", op, expected, describeType(operandType))
+	}
+}
+
+func (tc *typeChecker) typeOfCall(call *ast.CallExpr) string {
+	// resolve the class the same way the code generator does
+	className := tc.className
+	if call.Receiver != nil {
+		className = call.Receiver.Name
+		// calls on int, char or boolean variables are reported by the compilation engine
+		if item, ok := tc.symbolTable.find(call.Receiver.Name); ok {
+			className = item.ttype
+		}
+	}
+
+	var sub *subroutineInfo
+	if cls, ok := tc.index.classes[className]; ok {
+		sub = cls.subroutines[call.Name.Name]
+	}
+
+	for i, arg := range call.Args {
+		argType := tc.typeOf(arg)
+		if sub == nil || i >= len(sub.params) {
+			continue
+		}
+		if param := sub.params[i]; !tc.assignable(param.ttype, argType) {
+			tc.errorf(ast.SpanOf(arg), "cannot use %s as argument %s (%s) of %s.%s",
+				describeType(argType), param.name, param.ttype, sub.className, sub.name)
+		}
+	}
+
+	if sub == nil {
+		return anyType
+	}
+	if sub.returnType == "void" {
+		return "void"
+	}
+	return sub.returnType
+}
+
+// assignable reports whether a value of type src can be stored in a variable of type dst
+func (tc *typeChecker) assignable(dst, src string) bool {
+	if dst == anyType || src == anyType || dst == src {
+		return true
+	}
+	if dst == "void" || src == "void" {
+		// value of a void subroutine
+		return false
+	}
+	if tc.level == TypeCheckLoose {
+		// numbers and objects are all 16 bits words, booleans are the usual mistake
+		return dst != "boolean" && src != "boolean"
+	}
+	if isNumericType(dst) && isNumericType(src) {
+		return true
+	}
+	if isPrimitiveType(dst) || isPrimitiveType(src) {
+		return false
+	}
+	// null and Array (the generic pointer) are compatible with every object
+	return src == nullType || src == "Array" || dst == "Array"
+}
+
+func (tc *typeChecker) errorf(span ast.Span, format string, args ...any) *diag.Diagnostic {
+	d := diag.Errorf("type", span, format, args...)
+	tc.diagnostics = append(tc.diagnostics, d)
+	return d
+}
+
+func isPrimitiveType(ttype string) bool {
+	return ttype == "int" || ttype == "char" || ttype == "boolean"
+}
+
+func isNumericType(ttype string) bool {
+	return ttype == "int" || ttype == "char"
+}
+
+// describeType type for the diagnostics, e.g. a value of type int
+func describeType(ttype string) string {
+	switch ttype {
+	case nullType:
+		return "null"
+	case "void":
+		return "the result of a void subroutine"
+	}
+	return "a value of type " + ttype
+}
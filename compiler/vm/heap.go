@@ -0,0 +1,74 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// block free segment of the heap
+type block struct {
+	address int16
+	size    int16
+}
+
+// heap first fit allocator, the block sizes are kept aside so objects are laid out as with the
+// Jack OS (the object starts at the address returned)
+type heap struct {
+	blocks []block         // free blocks, ordered by address
+	used   map[int16]int16 // size of the allocated blocks
+}
+
+func newHeap(base, end int16) *heap {
+	return &heap{
+		blocks: []block{{address: base, size: end - base}},
+		used:   make(map[int16]int16),
+	}
+}
+
+func (h *heap) alloc(size int16) (int16, error) {
+	if size < 0 {
+		return 0, fmt.Errorf("cannot allocate %d words", size)
+	}
+	if size == 0 {
+		// objects without fields still need an address of their own
+		size = 1
+	}
+	for i, b := range h.blocks {
+		if b.size < size {
+			continue
+		}
+		if b.size == size {
+			h.blocks = append(h.blocks[:i], h.blocks[i+1:]...)
+		} else {
+			h.blocks[i] = block{address: b.address + size, size: b.size - size}
+		}
+		h.used[b.address] = size
+		return b.address, nil
+	}
+	return 0, errors.New("heap overflow")
+}
+
+func (h *heap) free(address int16) error {
+	size, ok := h.used[address]
+	if !ok {
+		return fmt.Errorf("address %d was not allocated", address)
+	}
+	delete(h.used, address)
+
+	i := sort.Search(len(h.blocks), func(i int) bool { return h.blocks[i].address > address })
+	h.blocks = append(h.blocks, block{})
+	copy(h.blocks[i+1:], h.blocks[i:])
+	h.blocks[i] = block{address: address, size: size}
+
+	// merge with the following and preceding blocks
+	if i+1 < len(h.blocks) && address+size == h.blocks[i+1].address {
+		h.blocks[i].size += h.blocks[i+1].size
+		h.blocks = append(h.blocks[:i+1], h.blocks[i+2:]...)
+	}
+	if i > 0 && h.blocks[i-1].address+h.blocks[i-1].size == address {
+		h.blocks[i-1].size += h.blocks[i].size
+		h.blocks = append(h.blocks[:i], h.blocks[i+1:]...)
+	}
+	return nil
+}
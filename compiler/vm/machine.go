@@ -0,0 +1,468 @@
+// Package vm runs VM code (projects 7 and 8) on a simulated Hack memory, the Jack OS classes not
+// loaded from VM files are implemented natively: text output goes to a writer and the keyboard reads
+// from a reader, the screen is not simulated.
+package vm
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// memory map
+const (
+	ramSize    = 32768
+	stackBase  = 256
+	staticBase = 16
+	staticEnd  = 256
+	heapBase   = 2048
+	heapEnd    = 16384 // screen memory map
+)
+
+// registers
+const (
+	regSP = iota
+	regLCL
+	regARG
+	regTHIS
+	regTHAT
+	regTemp = 5
+)
+
+// ErrStepLimit the program was stopped after running the maximum number of instructions
+var ErrStepLimit = errors.New("step limit reached")
+
+// haltAddress return address of the first call, returning to it stops the machine
+const haltAddress = -1
+
+// maxCode instructions of a program at most, the return addresses are code indexes saved in RAM
+const maxCode = 32767
+
+type instruction struct {
+	command string
+	segment string
+	index   int
+	name    string // function called or declared, label jumped to
+	address int    // static address, jump target or entry point
+	native  native // OS function implemented natively
+	file    string
+	line    int
+}
+
+func (ins *instruction) String() string {
+	return fmt.Sprintf("%s.vm:%d", ins.file, ins.line)
+}
+
+// Machine VM code interpreter, files are loaded one after the other and linked when run
+type Machine struct {
+	RAM       [ramSize]int16
+	code      []*instruction
+	functions map[string]int // entry point of the loaded functions
+	labels    map[string]int // function$label
+	statics   int            // next static address
+	heap      *heap
+	out       *bufio.Writer
+	in        *bufio.Reader
+	maxSteps  int
+	halted    bool
+}
+
+func New(out io.Writer, in io.Reader) *Machine {
+	return &Machine{
+		functions: make(map[string]int),
+		labels:    make(map[string]int),
+		statics:   staticBase,
+		heap:      newHeap(heapBase, heapEnd),
+		out:       bufio.NewWriter(out),
+		in:        bufio.NewReader(in),
+	}
+}
+
+// WithMaxSteps stops the program after n instructions (0 for no limit), programs waiting for a key
+// never end otherwise
+func (m *Machine) WithMaxSteps(n int) *Machine {
+	m.maxSteps = n
+	return m
+}
+
+// Load reads the VM code of a file, fileName (without extension) scopes its static variables
+func (m *Machine) Load(fileName string, src io.Reader) error {
+
+	var (
+		function   string
+		maxStatic  = -1
+		scanner    = bufio.NewScanner(src)
+		firstIndex = len(m.code)
+	)
+
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := scanner.Text()
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		ins := &instruction{command: fields[0], file: fileName, line: lineNo}
+		errorf := func(format string, args ...any) error {
+			return fmt.Errorf("%s: %s", ins, fmt.Sprintf(format, args...))
+		}
+
+		switch ins.command {
+		case "add", "sub", "neg", "eq", "gt", "lt", "and", "or", "not", "return":
+			if len(fields) != 1 {
+				return errorf("unexpected %s", fields[1])
+			}
+		case "push", "pop":
+			if len(fields) != 3 {
+				return errorf("expected %s segment index", ins.command)
+			}
+			index, err := strconv.Atoi(fields[2])
+			if err != nil || index < 0 {
+				return errorf("invalid index %s", fields[2])
+			}
+			ins.segment, ins.index = fields[1], index
+			switch ins.segment {
+			case "constant":
+				if ins.command == "pop" {
+					return errorf("cannot pop to segment constant")
+				}
+			case "local", "argument", "this", "that":
+			case "pointer", "temp":
+				if (ins.segment == "pointer" && index > 1) || index > 7 {
+					return errorf("%s index %d out of range", ins.segment, index)
+				}
+			case "static":
+				maxStatic = max(maxStatic, index)
+			default:
+				return errorf("unknown segment %s", ins.segment)
+			}
+		case "label", "goto", "if-goto":
+			if len(fields) != 2 {
+				return errorf("expected %s label", ins.command)
+			}
+			ins.name = function + "$" + fields[1]
+			if ins.command == "label" {
+				if _, ok := m.labels[ins.name]; ok {
+					return errorf("label %s is already declared", fields[1])
+				}
+				m.labels[ins.name] = len(m.code)
+			}
+		case "function", "call":
+			if len(fields) != 3 {
+				return errorf("expected %s name count", ins.command)
+			}
+			n, err := strconv.Atoi(fields[2])
+			if err != nil || n < 0 {
+				return errorf("invalid count %s", fields[2])
+			}
+			ins.name, ins.index = fields[1], n
+			if ins.command == "function" {
+				if _, ok := m.functions[ins.name]; ok {
+					return errorf("function %s is already declared", ins.name)
+				}
+				function = ins.name
+				m.functions[function] = len(m.code)
+			}
+		default:
+			return errorf("unknown command %s", ins.command)
+		}
+		m.code = append(m.code, ins)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(m.code) > maxCode {
+		return fmt.Errorf("%s.vm: the program is too long (more than %d instructions)", fileName, maxCode)
+	}
+
+	// static variables of the file
+	if m.statics+maxStatic >= staticEnd {
+		return fmt.Errorf("%s.vm: too many static variables", fileName)
+	}
+	for _, ins := range m.code[firstIndex:] {
+		if ins.segment == "static" {
+			ins.address = m.statics + ins.index
+		}
+	}
+	m.statics += maxStatic + 1
+
+	return nil
+}
+
+// link resolves the jumps and calls, the functions not loaded are looked up in the native OS
+func (m *Machine) link() error {
+	for _, ins := range m.code {
+		switch ins.command {
+		case "goto", "if-goto":
+			address, ok := m.labels[ins.name]
+			if !ok {
+				return fmt.Errorf("%s: unknown label %s", ins, ins.name[strings.Index(ins.name, "$")+1:])
+			}
+			ins.address = address
+		case "call":
+			if address, ok := m.functions[ins.name]; ok {
+				ins.address = address
+				continue
+			}
+			native, ok := nativeOS[ins.name]
+			if !ok {
+				return fmt.Errorf("%s: unknown function %s", ins, ins.name)
+			}
+			// the natives read their arguments without checking them
+			if ins.index != native.nArgs {
+				return fmt.Errorf("%s: wrong number of arguments for %s (expected %d, got %d)", ins, ins.name, native.nArgs, ins.index)
+			}
+			ins.native = native.call
+		}
+	}
+	return nil
+}
+
+// Run links the loaded files and runs Sys.init when it was loaded from a VM file, Main.main
+// otherwise (the native OS needs no initialization)
+func (m *Machine) Run() error {
+	defer m.out.Flush()
+
+	if err := m.link(); err != nil {
+		return err
+	}
+
+	entry := "Sys.init"
+	if _, ok := m.functions[entry]; !ok {
+		entry = "Main.main"
+	}
+	address, ok := m.functions[entry]
+	if !ok {
+		return fmt.Errorf("no %s function to run", entry)
+	}
+
+	m.RAM[regSP] = stackBase
+	if err := m.call(haltAddress, 0); err != nil {
+		return err
+	}
+	return m.execute(address)
+}
+
+func (m *Machine) execute(pc int) error {
+	for steps := 0; !m.halted; steps++ {
+		if m.maxSteps > 0 && steps >= m.maxSteps {
+			return ErrStepLimit
+		}
+		if pc < 0 || pc >= len(m.code) {
+			return fmt.Errorf("jumped outside of the program (%d)", pc)
+		}
+
+		ins := m.code[pc]
+		next, err := m.step(pc, ins)
+		if err != nil {
+			return fmt.Errorf("%s: %w", ins, err)
+		}
+		if next == haltAddress {
+			return nil
+		}
+		pc = next
+	}
+	return nil
+}
+
+// step runs a single instruction returning the next one
+func (m *Machine) step(pc int, ins *instruction) (int, error) {
+	switch ins.command {
+	case "add", "sub", "and", "or", "eq", "gt", "lt":
+		y, err := m.pop()
+		if err != nil {
+			return 0, err
+		}
+		x, err := m.pop()
+		if err != nil {
+			return 0, err
+		}
+		return pc + 1, m.push(binary(ins.command, x, y))
+	case "neg", "not":
+		x, err := m.pop()
+		if err != nil {
+			return 0, err
+		}
+		if ins.command == "neg" {
+			return pc + 1, m.push(-x)
+		}
+		return pc + 1, m.push(^x)
+	case "push":
+		address, err := m.address(ins)
+		if err != nil {
+			return 0, err
+		}
+		if ins.segment == "constant" {
+			return pc + 1, m.push(int16(ins.index))
+		}
+		return pc + 1, m.push(m.RAM[address])
+	case "pop":
+		address, err := m.address(ins)
+		if err != nil {
+			return 0, err
+		}
+		value, err := m.pop()
+		if err != nil {
+			return 0, err
+		}
+		m.RAM[address] = value
+	case "label":
+	case "goto":
+		return ins.address, nil
+	case "if-goto":
+		value, err := m.pop()
+		if err != nil {
+			return 0, err
+		}
+		if value != 0 {
+			return ins.address, nil
+		}
+	case "function":
+		for range ins.index {
+			if err := m.push(0); err != nil {
+				return 0, err
+			}
+		}
+	case "call":
+		if ins.native != nil {
+			return pc + 1, m.callNative(ins)
+		}
+		if err := m.call(pc+1, ins.index); err != nil {
+			return 0, err
+		}
+		return ins.address, nil
+	case "return":
+		return m.ret()
+	}
+	return pc + 1, nil
+}
+
+func binary(command string, x, y int16) int16 {
+	switch command {
+	case "add":
+		return x + y
+	case "sub":
+		return x - y
+	case "and":
+		return x & y
+	case "or":
+		return x | y
+	case "eq":
+		return boolean(x == y)
+	case "gt":
+		return boolean(x > y)
+	}
+	return boolean(x < y)
+}
+
+// boolean true is -1 (all bits set)
+func boolean(b bool) int16 {
+	if b {
+		return -1
+	}
+	return 0
+}
+
+// address RAM address of a push or pop
+func (m *Machine) address(ins *instruction) (int, error) {
+	var address int
+	switch ins.segment {
+	case "constant":
+		return 0, nil
+	case "local":
+		address = int(m.RAM[regLCL]) + ins.index
+	case "argument":
+		address = int(m.RAM[regARG]) + ins.index
+	case "this":
+		address = int(m.RAM[regTHIS]) + ins.index
+	case "that":
+		address = int(m.RAM[regTHAT]) + ins.index
+	case "pointer":
+		address = regTHIS + ins.index
+	case "temp":
+		address = regTemp + ins.index
+	case "static":
+		address = ins.address
+	}
+	if address < 0 || address >= ramSize {
+		return 0, fmt.Errorf("%s %d is out of memory (address %d)", ins.segment, ins.index, address)
+	}
+	return address, nil
+}
+
+// call saves the frame of the caller, the return address is a code index
+func (m *Machine) call(returnAddress, nArgs int) error {
+	sp := m.RAM[regSP]
+	for _, value := range []int16{int16(returnAddress), m.RAM[regLCL], m.RAM[regARG], m.RAM[regTHIS], m.RAM[regTHAT]} {
+		if err := m.push(value); err != nil {
+			return err
+		}
+	}
+	m.RAM[regARG] = sp - int16(nArgs)
+	m.RAM[regLCL] = m.RAM[regSP]
+	return nil
+}
+
+// ret restores the frame of the caller returning its next instruction
+func (m *Machine) ret() (int, error) {
+	frame := int(m.RAM[regLCL])
+	if frame < stackBase+5 {
+		return 0, errors.New("return outside of a function")
+	}
+	returnAddress := int(m.RAM[frame-5])
+	arg := m.RAM[regARG]
+	if arg < stackBase || int(arg) > frame-5 {
+		return 0, errors.New("corrupted frame")
+	}
+	value, err := m.pop()
+	if err != nil {
+		return 0, err
+	}
+	m.RAM[arg] = value
+	m.RAM[regSP] = m.RAM[regARG] + 1
+	m.RAM[regTHAT] = m.RAM[frame-1]
+	m.RAM[regTHIS] = m.RAM[frame-2]
+	m.RAM[regARG] = m.RAM[frame-3]
+	m.RAM[regLCL] = m.RAM[frame-4]
+	return returnAddress, nil
+}
+
+func (m *Machine) callNative(ins *instruction) error {
+	sp := int(m.RAM[regSP])
+	if sp-ins.index < stackBase {
+		return errors.New("stack underflow")
+	}
+	args := make([]int16, ins.index)
+	copy(args, m.RAM[sp-ins.index:sp])
+	m.RAM[regSP] -= int16(ins.index)
+
+	value, err := ins.native(m, args)
+	if err != nil {
+		return fmt.Errorf("%s: %w", ins.name, err)
+	}
+	return m.push(value)
+}
+
+func (m *Machine) push(value int16) error {
+	sp := m.RAM[regSP]
+	if sp < stackBase || int(sp) >= heapBase {
+		return errors.New("stack overflow")
+	}
+	m.RAM[sp] = value
+	m.RAM[regSP]++
+	return nil
+}
+
+func (m *Machine) pop() (int16, error) {
+	if m.RAM[regSP] <= stackBase {
+		return 0, errors.New("stack underflow")
+	}
+	m.RAM[regSP]--
+	return m.RAM[m.RAM[regSP]], nil
+}
@@ -0,0 +1,97 @@
+package vm
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunTestdata(t *testing.T) {
+	tests := map[string]string{
+		"Seven": "7",
+		"ComplexArrays": "Test 1: expected result: 5; actual result: 5\n" +
+			"Test 2: expected result: 40; actual result: 40\n" +
+			"Test 3: expected result: 0; actual result: 0\n" +
+			"Test 4: expected result: 77; actual result: 77\n" +
+			"Test 5: expected result: 110; actual result: 110\n",
+	}
+	for name, want := range tests {
+		t.Run(name, func(t *testing.T) {
+			paths, err := filepath.Glob(filepath.Join("../../testdata/compiler", name, "A/*.vm"))
+			if err != nil || len(paths) == 0 {
+				t.Fatalf("no VM files found (%v)", err)
+			}
+			var out strings.Builder
+			m := New(&out, strings.NewReader("")).WithMaxSteps(10_000_000)
+			for _, path := range paths {
+				src, err := os.Open(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = m.Load(strings.TrimSuffix(filepath.Base(path), ".vm"), src)
+				src.Close()
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := m.Run(); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != want {
+				t.Errorf("got %q, want %q", out.String(), want)
+			}
+		})
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	tests := map[string]struct {
+		code string
+		want string
+	}{
+		"unknown function": {"function Main.main 0\ncall Main.f 0\nreturn", "unknown function Main.f"},
+		"unknown label":    {"function Main.main 0\ngoto END\nreturn", "unknown label END"},
+		"stack overflow":   {"function Main.main 0\ncall Main.main 0\nreturn", "stack overflow"},
+		"division by zero": {"function Main.main 0\npush constant 1\npush constant 0\ncall Math.divide 2\nreturn", "division by zero"},
+		"out of memory":    {"function Main.main 0\npush constant 32767\npop pointer 1\npush that 1\nreturn", "out of memory"},
+		"step limit":       {"function Main.main 0\nlabel LOOP\ngoto LOOP", ErrStepLimit.Error()},
+		"no entry point":   {"function Main.f 0\npush constant 0\nreturn", "no Main.main function to run"},
+		"native arity":     {"function Main.main 0\ncall Math.abs 0\nreturn", "wrong number of arguments for Math.abs (expected 1, got 0)"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			m := New(new(strings.Builder), strings.NewReader("")).WithMaxSteps(1000)
+			if err := m.Load("Main", strings.NewReader(test.code)); err != nil {
+				t.Fatal(err)
+			}
+			err := m.Run()
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got error %v, want %q", err, test.want)
+			}
+			if name == "step limit" && !errors.Is(err, ErrStepLimit) {
+				t.Errorf("got error %v, want ErrStepLimit", err)
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := map[string]string{
+		"push":     "push constant",
+		"pop":      "pop constant 0",
+		"segment":  "push heap 0",
+		"pointer":  "push pointer 2",
+		"command":  "jump 1",
+		"function": "function Main.f 0\nfunction Main.f 0",
+		"too long": "function Main.f 0\n" + strings.Repeat("push constant 0\n", maxCode),
+	}
+	for name, code := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := New(nil, nil).Load("Main", strings.NewReader(code)); err == nil {
+				t.Errorf("%q loaded without errors", code)
+			}
+		})
+	}
+}
@@ -0,0 +1,410 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// native OS function, called with its arguments and returning the value pushed on the stack
+type native func(m *Machine, args []int16) (int16, error)
+
+// Jack OS character set
+const (
+	charNewLine     = 128
+	charBackSpace   = 129
+	charDoubleQuote = 34
+)
+
+// string objects: [maxLength, length, chars...]
+const (
+	strMaxLength = 0
+	strLength    = 1
+	strChars     = 2
+)
+
+// nativeFunction OS function implemented natively along with its number of arguments (this included)
+type nativeFunction struct {
+	nArgs int
+	call  native
+}
+
+// nativeOS the Jack OS API, the init functions do nothing as the machine starts ready
+var nativeOS = map[string]nativeFunction{
+	"Sys.init":  {0, sysInit},
+	"Sys.halt":  {0, func(m *Machine, _ []int16) (int16, error) { m.halted = true; return 0, nil }},
+	"Sys.error": {1, func(m *Machine, args []int16) (int16, error) { return 0, fmt.Errorf("ERR%d", args[0]) }},
+	"Sys.wait":  {1, nop},
+
+	"Math.init":     {0, nop},
+	"Math.abs":      {1, func(_ *Machine, args []int16) (int16, error) { return max(args[0], -args[0]), nil }},
+	"Math.multiply": {2, func(_ *Machine, args []int16) (int16, error) { return args[0] * args[1], nil }},
+	"Math.divide":   {2, mathDivide},
+	"Math.min":      {2, func(_ *Machine, args []int16) (int16, error) { return min(args[0], args[1]), nil }},
+	"Math.max":      {2, func(_ *Machine, args []int16) (int16, error) { return max(args[0], args[1]), nil }},
+	"Math.sqrt":     {1, mathSqrt},
+
+	"Memory.init":    {0, nop},
+	"Memory.peek":    {1, memoryPeek},
+	"Memory.poke":    {2, memoryPoke},
+	"Memory.alloc":   {1, memoryAlloc},
+	"Memory.deAlloc": {1, memoryDeAlloc},
+	"Array.new":      {1, memoryAlloc},
+	"Array.dispose":  {1, memoryDeAlloc},
+
+	"String.new":           {1, stringNew},
+	"String.dispose":       {1, memoryDeAlloc},
+	"String.length":        {1, stringLength},
+	"String.charAt":        {2, stringCharAt},
+	"String.setCharAt":     {3, stringSetCharAt},
+	"String.appendChar":    {2, stringAppendChar},
+	"String.eraseLastChar": {1, stringEraseLastChar},
+	"String.intValue":      {1, stringIntValue},
+	"String.setInt":        {2, stringSetInt},
+	"String.backSpace":     {0, func(*Machine, []int16) (int16, error) { return charBackSpace, nil }},
+	"String.doubleQuote":   {0, func(*Machine, []int16) (int16, error) { return charDoubleQuote, nil }},
+	"String.newLine":       {0, func(*Machine, []int16) (int16, error) { return charNewLine, nil }},
+
+	"Output.init":        {0, nop},
+	"Output.moveCursor":  {2, nop},
+	"Output.printChar":   {1, func(m *Machine, args []int16) (int16, error) { return 0, m.printChar(args[0]) }},
+	"Output.printString": {1, outputPrintString},
+	"Output.printInt":    {1, func(m *Machine, args []int16) (int16, error) { return 0, m.print(strconv.Itoa(int(args[0]))) }},
+	"Output.println":     {0, func(m *Machine, _ []int16) (int16, error) { return 0, m.printChar(charNewLine) }},
+	"Output.backSpace":   {0, func(m *Machine, _ []int16) (int16, error) { return 0, m.printChar(charBackSpace) }},
+
+	"Screen.init":          {0, nop},
+	"Screen.clearScreen":   {0, nop},
+	"Screen.setColor":      {1, nop},
+	"Screen.drawPixel":     {2, nop},
+	"Screen.drawLine":      {4, nop},
+	"Screen.drawRectangle": {4, nop},
+	"Screen.drawCircle":    {3, nop},
+
+	"Keyboard.init":       {0, nop},
+	"Keyboard.keyPressed": {0, nop}, // no key is ever pressed
+	"Keyboard.readChar":   {0, keyboardReadChar},
+	"Keyboard.readLine":   {1, keyboardReadLine},
+	"Keyboard.readInt":    {1, keyboardReadInt},
+}
+
+func nop(*Machine, []int16) (int16, error) {
+	return 0, nil
+}
+
+// sysInit runs Main.main, for programs without their own Sys.init
+func sysInit(m *Machine, _ []int16) (int16, error) {
+	address, ok := m.functions["Main.main"]
+	if !ok {
+		return 0, errors.New("no Main.main function to run")
+	}
+	if err := m.call(haltAddress, 0); err != nil {
+		return 0, err
+	}
+	return 0, m.execute(address)
+}
+
+func mathDivide(_ *Machine, args []int16) (int16, error) {
+	if args[1] == 0 {
+		return 0, errors.New("division by zero")
+	}
+	return args[0] / args[1], nil
+}
+
+func mathSqrt(_ *Machine, args []int16) (int16, error) {
+	if args[0] < 0 {
+		return 0, errors.New("cannot compute the square root of a negative number")
+	}
+	var y int16
+	for (y+1)*(y+1) <= args[0] && (y+1)*(y+1) > 0 {
+		y++
+	}
+	return y, nil
+}
+
+func memoryPeek(m *Machine, args []int16) (int16, error) {
+	if args[0] < 0 {
+		return 0, fmt.Errorf("address %d is out of memory", args[0])
+	}
+	return m.RAM[args[0]], nil
+}
+
+func memoryPoke(m *Machine, args []int16) (int16, error) {
+	if args[0] < 0 {
+		return 0, fmt.Errorf("address %d is out of memory", args[0])
+	}
+	m.RAM[args[0]] = args[1]
+	return 0, nil
+}
+
+func memoryAlloc(m *Machine, args []int16) (int16, error) {
+	if args[0] < 0 {
+		return 0, fmt.Errorf("cannot allocate %d words", args[0])
+	}
+	return m.heap.alloc(args[0])
+}
+
+func memoryDeAlloc(m *Machine, args []int16) (int16, error) {
+	return 0, m.heap.free(args[0])
+}
+
+func stringNew(m *Machine, args []int16) (int16, error) {
+	if args[0] < 0 {
+		return 0, fmt.Errorf("invalid string length %d", args[0])
+	}
+	s, err := m.heap.alloc(args[0] + strChars)
+	if err != nil {
+		return 0, err
+	}
+	m.RAM[s+strMaxLength] = args[0]
+	m.RAM[s+strLength] = 0
+	return s, nil
+}
+
+func stringLength(m *Machine, args []int16) (int16, error) {
+	length, _, err := m.length(args[0])
+	return length, err
+}
+
+func stringCharAt(m *Machine, args []int16) (int16, error) {
+	address, err := m.char(args[0], args[1])
+	if err != nil {
+		return 0, err
+	}
+	return m.RAM[address], nil
+}
+
+func stringSetCharAt(m *Machine, args []int16) (int16, error) {
+	address, err := m.char(args[0], args[1])
+	if err != nil {
+		return 0, err
+	}
+	m.RAM[address] = args[2]
+	return 0, nil
+}
+
+func stringAppendChar(m *Machine, args []int16) (int16, error) {
+	s := args[0]
+	length, maxLength, err := m.length(s)
+	if err != nil {
+		return 0, err
+	}
+	if length == maxLength {
+		return 0, errors.New("string is full")
+	}
+	m.RAM[int(s)+strChars+int(length)] = args[1]
+	m.RAM[int(s)+strLength]++
+	return s, nil
+}
+
+func stringEraseLastChar(m *Machine, args []int16) (int16, error) {
+	length, _, err := m.length(args[0])
+	if err != nil {
+		return 0, err
+	}
+	if length == 0 {
+		return 0, errors.New("string is empty")
+	}
+	m.RAM[int(args[0])+strLength]--
+	return 0, nil
+}
+
+func stringIntValue(m *Machine, args []int16) (int16, error) {
+	text, err := m.string(args[0])
+	if err != nil {
+		return 0, err
+	}
+	return parseInt(text), nil
+}
+
+func stringSetInt(m *Machine, args []int16) (int16, error) {
+	s := args[0]
+	text := strconv.Itoa(int(args[1]))
+	_, maxLength, err := m.length(s)
+	if err != nil {
+		return 0, err
+	}
+	if len(text) > int(maxLength) {
+		return 0, errors.New("string is too short")
+	}
+	for i, ch := range []byte(text) {
+		m.RAM[int(s)+strChars+i] = int16(ch)
+	}
+	m.RAM[int(s)+strLength] = int16(len(text))
+	return 0, nil
+}
+
+func outputPrintString(m *Machine, args []int16) (int16, error) {
+	text, err := m.string(args[0])
+	if err != nil {
+		return 0, err
+	}
+	return 0, m.print(text)
+}
+
+func keyboardReadChar(m *Machine, _ []int16) (int16, error) {
+	return m.readChar()
+}
+
+func keyboardReadLine(m *Machine, args []int16) (int16, error) {
+	message, err := m.string(args[0])
+	if err != nil {
+		return 0, err
+	}
+	if err := m.print(message); err != nil {
+		return 0, err
+	}
+
+	var line []int16
+	for {
+		ch, err := m.readChar()
+		if err != nil {
+			return 0, err
+		}
+		if ch == charNewLine {
+			break
+		}
+		// backspace erases the last character typed
+		if ch == charBackSpace {
+			if len(line) > 0 {
+				line = line[:len(line)-1]
+			}
+			continue
+		}
+		line = append(line, ch)
+	}
+
+	s, err := stringNew(m, []int16{int16(len(line))})
+	if err != nil {
+		return 0, err
+	}
+	copy(m.RAM[s+strChars:], line)
+	m.RAM[s+strLength] = int16(len(line))
+	return s, nil
+}
+
+func keyboardReadInt(m *Machine, args []int16) (int16, error) {
+	s, err := keyboardReadLine(m, args)
+	if err != nil {
+		return 0, err
+	}
+	value, err := stringIntValue(m, []int16{s})
+	if err != nil {
+		return 0, err
+	}
+	return value, m.heap.free(s)
+}
+
+// parseInt value of the leading digits of text (optionally negative), as String.intValue
+func parseInt(text string) int16 {
+	var (
+		value    int16
+		negative = strings.HasPrefix(text, "-")
+	)
+	for _, ch := range strings.TrimPrefix(text, "-") {
+		if ch < '0' || ch > '9' {
+			break
+		}
+		value = value*10 + int16(ch-'0')
+	}
+	if negative {
+		return -value
+	}
+	return value
+}
+
+// field reads a field of an object allocated on the heap
+func (m *Machine) field(object int16, index int) (int16, error) {
+	if object < heapBase || int(object)+index >= heapEnd {
+		return 0, fmt.Errorf("invalid object %d", object)
+	}
+	return m.RAM[int(object)+index], nil
+}
+
+// length reads the length and maximum length of a string object, checking that its characters are
+// within the memory (any object can be passed where a string is expected)
+func (m *Machine) length(s int16) (length, maxLength int16, err error) {
+	if maxLength, err = m.field(s, strMaxLength); err != nil {
+		return 0, 0, err
+	}
+	if length, err = m.field(s, strLength); err != nil {
+		return 0, 0, err
+	}
+	if maxLength < 0 || int(s)+strChars+int(maxLength) > ramSize {
+		return 0, 0, fmt.Errorf("invalid string %d (maximum length %d)", s, maxLength)
+	}
+	if length < 0 || length > maxLength {
+		return 0, 0, fmt.Errorf("invalid string %d (length %d, maximum length %d)", s, length, maxLength)
+	}
+	return length, maxLength, nil
+}
+
+// char address of the character j of a string
+func (m *Machine) char(s, j int16) (int, error) {
+	length, _, err := m.length(s)
+	if err != nil {
+		return 0, err
+	}
+	if j < 0 || j >= length {
+		return 0, fmt.Errorf("index %d out of range (length %d)", j, length)
+	}
+	return int(s) + strChars + int(j), nil
+}
+
+// string text of a string object
+func (m *Machine) string(s int16) (string, error) {
+	length, _, err := m.length(s)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	for _, ch := range m.RAM[int(s)+strChars : int(s)+strChars+int(length)] {
+		sb.WriteString(character(ch))
+	}
+	return sb.String(), nil
+}
+
+func (m *Machine) print(text string) error {
+	_, err := m.out.WriteString(text)
+	return err
+}
+
+func (m *Machine) printChar(ch int16) error {
+	return m.print(character(ch))
+}
+
+// character text printed for a character of the Jack character set
+func character(ch int16) string {
+	switch ch {
+	case charNewLine:
+		return "\n"
+	case charBackSpace:
+		return "\b"
+	}
+	return string(rune(ch))
+}
+
+// readChar reads the next character typed, the output is flushed first so prompts are shown
+func (m *Machine) readChar() (int16, error) {
+	if err := m.out.Flush(); err != nil {
+		return 0, err
+	}
+	ch, err := m.in.ReadByte()
+	if err == io.EOF {
+		return 0, errors.New("end of input")
+	}
+	if err != nil {
+		return 0, err
+	}
+	switch ch {
+	case '\r':
+		return m.readChar()
+	case '\n':
+		return charNewLine, nil
+	case '\b', 0x7f:
+		return charBackSpace, nil
+	}
+	return int16(ch), nil
+}
@@ -0,0 +1,110 @@
+package vm
+
+import (
+	"strings"
+	"testing"
+)
+
+// notString VM code of Main.main storing an array with a negative length as local 0, followed by
+// the code using it as a string
+const notString = `
+function Main.main 1
+push constant 3
+call Array.new 1
+pop local 0
+push constant 1
+push local 0
+add
+pop pointer 1
+push constant 5
+neg
+pop that 0
+%s
+push constant 0
+return
+`
+
+func TestStringOfAnotherObject(t *testing.T) {
+	tests := map[string]string{
+		"printString":   "push local 0\ncall Output.printString 1",
+		"length":        "push local 0\ncall String.length 1",
+		"charAt":        "push local 0\npush constant 0\ncall String.charAt 2",
+		"setCharAt":     "push local 0\npush constant 0\npush constant 65\ncall String.setCharAt 3",
+		"appendChar":    "push local 0\npush constant 65\ncall String.appendChar 2",
+		"eraseLastChar": "push local 0\ncall String.eraseLastChar 1",
+		"intValue":      "push local 0\ncall String.intValue 1",
+		"setInt":        "push local 0\npush constant 12\ncall String.setInt 2",
+	}
+	for name, code := range tests {
+		t.Run(name, func(t *testing.T) {
+			var out strings.Builder
+			m := New(&out, strings.NewReader("")).WithMaxSteps(1000)
+			if err := m.Load("Main", strings.NewReader(strings.Replace(notString, "%s", code, 1))); err != nil {
+				t.Fatal(err)
+			}
+			err := m.Run()
+			if err == nil || !strings.Contains(err.Error(), "invalid string") {
+				t.Fatalf("got error %v, want an invalid string error", err)
+			}
+			if out.Len() > 0 {
+				t.Errorf("unexpected output %q", out.String())
+			}
+		})
+	}
+}
+
+func TestStringOutOfMemory(t *testing.T) {
+	// an object at the end of the heap claiming more characters than the memory holds
+	var out strings.Builder
+	m := New(&out, strings.NewReader(""))
+	s := int16(heapEnd - strChars)
+	m.RAM[s+strMaxLength] = 32767
+	m.RAM[s+strLength] = 32767
+	if _, err := outputPrintString(m, []int16{s}); err == nil || !strings.Contains(err.Error(), "invalid string") {
+		t.Fatalf("got error %v, want an invalid string error", err)
+	}
+}
+
+func TestString(t *testing.T) {
+	var out strings.Builder
+	m := New(&out, strings.NewReader(""))
+	s, err := stringNew(m, []int16{3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ch := range "abc" {
+		if _, err := stringAppendChar(m, []int16{s, int16(ch)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := stringAppendChar(m, []int16{s, 'd'}); err == nil {
+		t.Error("appended a character to a full string")
+	}
+	if _, err := outputPrintString(m, []int16{s}); err != nil {
+		t.Fatal(err)
+	}
+	m.out.Flush()
+	if out.String() != "abc" {
+		t.Errorf("got %q, want %q", out.String(), "abc")
+	}
+}
+
+func TestKeyboardReadLine(t *testing.T) {
+	var out strings.Builder
+	m := New(&out, strings.NewReader("\babx\bc\x7f\x7fd\r\n"))
+	message, err := stringNew(m, []int16{0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := keyboardReadLine(m, []int16{message})
+	if err != nil {
+		t.Fatal(err)
+	}
+	line, err := m.string(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "ad" {
+		t.Errorf("got %q, want %q", line, "ad")
+	}
+}
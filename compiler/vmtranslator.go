@@ -0,0 +1,217 @@
+package compiler
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// VMTranslator translates VM code to Hack assembly (projects 7 and 8), the files of a program are
+// translated one after the other into the same destination
+type VMTranslator struct {
+	dst      io.Writer
+	fileName string // static variables are named after the file (Foo.vm -> Foo.i)
+	function string // labels are scoped by the function declaring them
+	counter  int    // unique labels for comparisons and return addresses
+}
+
+func NewVMTranslator(dst io.Writer) *VMTranslator {
+	return &VMTranslator{dst: dst}
+}
+
+// segmentBases registers holding the base address of the segments
+var segmentBases = map[string]string{
+	"local":    "LCL",
+	"argument": "ARG",
+	"this":     "THIS",
+	"that":     "THAT",
+}
+
+// WriteBootstrap sets the stack pointer and calls Sys.init, for programs including the OS
+func (t *VMTranslator) WriteBootstrap() {
+	t.write("// bootstrap")
+	t.write("@256", "D=A", "@SP", "M=D")
+	t.writeCall("Sys.init", 0)
+}
+
+// Translate translates the VM code of a file, fileName (without extension) names its static variables
+func (t *VMTranslator) Translate(fileName string, src io.Reader) error {
+	t.fileName = fileName
+	t.function = ""
+
+	scanner := bufio.NewScanner(src)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := scanner.Text()
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		t.write("// " + strings.Join(fields, " "))
+		if err := t.translate(fields); err != nil {
+			return fmt.Errorf("%s:%d: %w", fileName, lineNo, err)
+		}
+	}
+	return scanner.Err()
+}
+
+func (t *VMTranslator) translate(fields []string) error {
+	command := fields[0]
+
+	switch command {
+	case "add", "sub", "and", "or":
+		op := map[string]string{"add": "D+M", "sub": "M-D", "and": "D&M", "or": "D|M"}[command]
+		t.write("@SP", "AM=M-1", "D=M", "A=A-1", "M="+op)
+	case "neg", "not":
+		op := map[string]string{"neg": "-M", "not": "!M"}[command]
+		t.write("@SP", "A=M-1", "M="+op)
+	case "eq", "gt", "lt":
+		label := t.label("CMP")
+		t.write("@SP", "AM=M-1", "D=M", "A=A-1", "D=M-D", "M=-1",
+			"@"+label, "D;J"+strings.ToUpper(command),
+			"@SP", "A=M-1", "M=0",
+			"("+label+")")
+	case "push", "pop":
+		if len(fields) != 3 {
+			return fmt.Errorf("expected %s segment index", command)
+		}
+		index, err := strconv.Atoi(fields[2])
+		if err != nil || index < 0 {
+			return fmt.Errorf("invalid index %s", fields[2])
+		}
+		if command == "push" {
+			return t.writePush(fields[1], index)
+		}
+		return t.writePop(fields[1], index)
+	case "label", "goto", "if-goto":
+		if len(fields) != 2 {
+			return fmt.Errorf("expected %s label", command)
+		}
+		label := t.function + "$" + fields[1]
+		switch command {
+		case "label":
+			t.write("(" + label + ")")
+		case "goto":
+			t.write("@"+label, "0;JMP")
+		default:
+			t.write("@SP", "AM=M-1", "D=M", "@"+label, "D;JNE")
+		}
+	case "function", "call":
+		if len(fields) != 3 {
+			return fmt.Errorf("expected %s name count", command)
+		}
+		n, err := strconv.Atoi(fields[2])
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid count %s", fields[2])
+		}
+		if command == "call" {
+			t.writeCall(fields[1], n)
+			break
+		}
+		t.function = fields[1]
+		t.write("(" + t.function + ")")
+		for range n {
+			t.write("@SP", "M=M+1", "A=M-1", "M=0")
+		}
+	case "return":
+		t.writeReturn()
+	default:
+		return fmt.Errorf("unknown command %s", command)
+	}
+	return nil
+}
+
+func (t *VMTranslator) writePush(segment string, index int) error {
+	switch segment {
+	case "constant":
+		t.write(fmt.Sprintf("@%d", index), "D=A")
+	case "local", "argument", "this", "that":
+		t.write("@"+segmentBases[segment], "D=M", fmt.Sprintf("@%d", index), "A=D+A", "D=M")
+	case "pointer", "temp", "static":
+		address, err := t.address(segment, index)
+		if err != nil {
+			return err
+		}
+		t.write("@"+address, "D=M")
+	default:
+		return fmt.Errorf("unknown segment %s", segment)
+	}
+	t.write("@SP", "M=M+1", "A=M-1", "M=D")
+	return nil
+}
+
+func (t *VMTranslator) writePop(segment string, index int) error {
+	switch segment {
+	case "local", "argument", "this", "that":
+		// target address in R13
+		t.write("@"+segmentBases[segment], "D=M", fmt.Sprintf("@%d", index), "D=D+A", "@R13", "M=D",
+			"@SP", "AM=M-1", "D=M", "@R13", "A=M", "M=D")
+	case "pointer", "temp", "static":
+		address, err := t.address(segment, index)
+		if err != nil {
+			return err
+		}
+		t.write("@SP", "AM=M-1", "D=M", "@"+address, "M=D")
+	default:
+		return fmt.Errorf("cannot pop to segment %s", segment)
+	}
+	return nil
+}
+
+// address symbol of the fixed segments (pointer, temp and static)
+func (t *VMTranslator) address(segment string, index int) (string, error) {
+	switch segment {
+	case "pointer":
+		if index > 1 {
+			return "", fmt.Errorf("pointer index %d out of range", index)
+		}
+		return fmt.Sprintf("R%d", 3+index), nil
+	case "temp":
+		if index > 7 {
+			return "", fmt.Errorf("temp index %d out of range", index)
+		}
+		return fmt.Sprintf("R%d", 5+index), nil
+	}
+	return fmt.Sprintf("%s.%d", t.fileName, index), nil
+}
+
+func (t *VMTranslator) writeCall(name string, nArgs int) {
+	ret := t.label(name + "$ret")
+	t.write("@"+ret, "D=A", "@SP", "M=M+1", "A=M-1", "M=D")
+	for _, register := range []string{"LCL", "ARG", "THIS", "THAT"} {
+		t.write("@"+register, "D=M", "@SP", "M=M+1", "A=M-1", "M=D")
+	}
+	// ARG = SP - 5 - nArgs, LCL = SP
+	t.write("@SP", "D=M", fmt.Sprintf("@%d", 5+nArgs), "D=D-A", "@ARG", "M=D",
+		"@SP", "D=M", "@LCL", "M=D",
+		"@"+name, "0;JMP",
+		"("+ret+")")
+}
+
+func (t *VMTranslator) writeReturn() {
+	// frame in R13, return address in R14
+	t.write("@LCL", "D=M", "@R13", "M=D",
+		"@5", "A=D-A", "D=M", "@R14", "M=D",
+		"@SP", "AM=M-1", "D=M", "@ARG", "A=M", "M=D",
+		"@ARG", "D=M+1", "@SP", "M=D")
+	for i, register := range []string{"THAT", "THIS", "ARG", "LCL"} {
+		t.write("@R13", "D=M", fmt.Sprintf("@%d", i+1), "A=D-A", "D=M", "@"+register, "M=D")
+	}
+	t.write("@R14", "A=M", "0;JMP")
+}
+
+// label unique label, prefixed for readability
+func (t *VMTranslator) label(prefix string) string {
+	t.counter++
+	return fmt.Sprintf("%s.%d", prefix, t.counter)
+}
+
+func (t *VMTranslator) write(lines ...string) {
+	for _, line := range lines {
+		_, _ = fmt.Fprintln(t.dst, line)
+	}
+}
@@ -0,0 +1,205 @@
+package compiler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// hackComp computations of the Hack C-instructions, a=1 reads M instead of A
+var hackComp = map[string]func(a, d, m int16) int16{
+	"0": func(a, d, m int16) int16 { return 0 }, "1": func(a, d, m int16) int16 { return 1 },
+	"-1": func(a, d, m int16) int16 { return -1 }, "D": func(a, d, m int16) int16 { return d },
+	"A": func(a, d, m int16) int16 { return a }, "M": func(a, d, m int16) int16 { return m },
+	"!D": func(a, d, m int16) int16 { return ^d }, "!A": func(a, d, m int16) int16 { return ^a },
+	"!M": func(a, d, m int16) int16 { return ^m }, "-D": func(a, d, m int16) int16 { return -d },
+	"-A": func(a, d, m int16) int16 { return -a }, "-M": func(a, d, m int16) int16 { return -m },
+	"D+1": func(a, d, m int16) int16 { return d + 1 }, "A+1": func(a, d, m int16) int16 { return a + 1 },
+	"M+1": func(a, d, m int16) int16 { return m + 1 }, "D-1": func(a, d, m int16) int16 { return d - 1 },
+	"A-1": func(a, d, m int16) int16 { return a - 1 }, "M-1": func(a, d, m int16) int16 { return m - 1 },
+	"D+A": func(a, d, m int16) int16 { return d + a }, "D+M": func(a, d, m int16) int16 { return d + m },
+	"D-A": func(a, d, m int16) int16 { return d - a }, "D-M": func(a, d, m int16) int16 { return d - m },
+	"A-D": func(a, d, m int16) int16 { return a - d }, "M-D": func(a, d, m int16) int16 { return m - d },
+	"D&A": func(a, d, m int16) int16 { return d & a }, "D&M": func(a, d, m int16) int16 { return d & m },
+	"D|A": func(a, d, m int16) int16 { return d | a }, "D|M": func(a, d, m int16) int16 { return d | m },
+}
+
+// hackJump conditions of the Hack jumps on the computed value
+var hackJump = map[string]func(v int16) bool{
+	"": func(int16) bool { return false }, "JGT": func(v int16) bool { return v > 0 },
+	"JEQ": func(v int16) bool { return v == 0 }, "JGE": func(v int16) bool { return v >= 0 },
+	"JLT": func(v int16) bool { return v < 0 }, "JNE": func(v int16) bool { return v != 0 },
+	"JLE": func(v int16) bool { return v <= 0 }, "JMP": func(int16) bool { return true },
+}
+
+// hackCPU assembles and runs Hack assembly, enough to check the results of the translated code
+type hackCPU struct {
+	rom     []string
+	symbols map[string]int
+	ram     [32768]int16
+}
+
+func newHackCPU(asm string) (*hackCPU, error) {
+	cpu := &hackCPU{symbols: map[string]int{"SP": 0, "LCL": 1, "ARG": 2, "THIS": 3, "THAT": 4}}
+	for i := range 16 {
+		cpu.symbols["R"+strconv.Itoa(i)] = i
+	}
+	// labels
+	for line := range strings.SplitSeq(asm, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "" || strings.HasPrefix(line, "//"):
+		case strings.HasPrefix(line, "("):
+			label := strings.Trim(line, "()")
+			if _, ok := cpu.symbols[label]; ok {
+				return nil, fmt.Errorf("label %s is declared twice", label)
+			}
+			cpu.symbols[label] = len(cpu.rom)
+		default:
+			cpu.rom = append(cpu.rom, line)
+		}
+	}
+	// variables
+	next := 16
+	for _, ins := range cpu.rom {
+		if symbol, ok := strings.CutPrefix(ins, "@"); ok {
+			if _, err := strconv.Atoi(symbol); err != nil {
+				if _, ok := cpu.symbols[symbol]; !ok {
+					cpu.symbols[symbol] = next
+					next++
+				}
+			}
+		}
+	}
+	return cpu, nil
+}
+
+// run executes steps instructions
+func (cpu *hackCPU) run(steps int) error {
+	var a, d int16
+	for pc := 0; steps > 0; steps-- {
+		if pc < 0 || pc >= len(cpu.rom) {
+			return fmt.Errorf("jumped outside of the program (%d)", pc)
+		}
+		ins := cpu.rom[pc]
+		pc++
+		if symbol, ok := strings.CutPrefix(ins, "@"); ok {
+			if value, err := strconv.Atoi(symbol); err == nil {
+				a = int16(value)
+			} else {
+				a = int16(cpu.symbols[symbol])
+			}
+			continue
+		}
+
+		dest, comp, jump := "", ins, ""
+		if i := strings.Index(comp, "="); i >= 0 {
+			dest, comp = comp[:i], comp[i+1:]
+		}
+		if i := strings.Index(comp, ";"); i >= 0 {
+			comp, jump = comp[:i], comp[i+1:]
+		}
+		compute, ok := hackComp[comp]
+		if !ok {
+			return fmt.Errorf("unknown computation %s", ins)
+		}
+		var m int16
+		if a >= 0 {
+			m = cpu.ram[a]
+		}
+		value := compute(a, d, m)
+		if strings.Contains(dest, "M") {
+			if a < 0 {
+				return fmt.Errorf("address %d out of memory (%s)", a, ins)
+			}
+			cpu.ram[a] = value
+		}
+		if strings.Contains(dest, "D") {
+			d = value
+		}
+		if strings.Contains(dest, "A") {
+			a = value
+		}
+		if hackJump[jump](value) {
+			pc = int(a)
+		}
+	}
+	return nil
+}
+
+func TestVMTranslator(t *testing.T) {
+	files := []struct {
+		name string
+		code string
+	}{
+		{"Sys", `
+function Sys.init 0
+call Main.main 0
+pop temp 1
+label HALT
+goto HALT
+`},
+		{"Main", `
+// (7 + 8) - 3, then comparisons
+function Main.main 0
+push constant 7
+push constant 8
+call Main.add 2
+push constant 3
+sub
+pop static 0
+push constant 5
+push constant 5
+eq
+pop static 1
+push constant 3
+push constant 5
+lt
+pop static 2
+push constant 3
+push constant 5
+gt
+pop static 3
+push constant 2
+neg
+pop temp 0
+push constant 42
+return
+
+function Main.add 1
+push argument 0
+push argument 1
+add
+pop local 0
+push local 0
+return
+`},
+	}
+
+	var asm strings.Builder
+	translator := NewVMTranslator(&asm)
+	translator.WriteBootstrap()
+	for _, file := range files {
+		if err := translator.Translate(file.name, strings.NewReader(file.code)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cpu, err := newHackCPU(asm.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cpu.run(2000); err != nil {
+		t.Fatal(err)
+	}
+
+	// Sys.init is running, its frame starts at 256 and the value of Main.main was popped
+	for symbol, want := range map[string]int16{
+		"Main.0": 12, "Main.1": -1, "Main.2": -1, "Main.3": 0,
+		"R5": -2, "R6": 42, "SP": 261,
+	} {
+		if got := cpu.ram[cpu.symbols[symbol]]; got != want {
+			t.Errorf("%s = %d, want %d", symbol, got, want)
+		}
+	}
+}
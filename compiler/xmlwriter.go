@@ -0,0 +1,305 @@
+package compiler
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Dudssource/dd-jack-compiler/compiler/ast"
+)
+
+// xmlWriter walks the syntax tree of a class printing the parse tree in the format of the
+// nand2tetris project 10 analyzer (one element per line, two spaces of indentation)
+type xmlWriter struct {
+	dstFile io.Writer
+	depth   int
+	lines   int
+}
+
+func newXMLWriter(dstFile io.Writer) *xmlWriter {
+	return &xmlWriter{dstFile: dstFile}
+}
+
+func (w *xmlWriter) writeClass(class *ast.Class) {
+	w.open("class")
+	{
+		w.keyword("class")
+		w.identifier(class.Name.Name)
+		w.symbol("{")
+		for _, dec := range class.Vars {
+			w.writeClassVarDec(dec)
+		}
+		for _, dec := range class.Subroutines {
+			w.writeSubroutineDec(dec)
+		}
+		w.symbol("}")
+	}
+	w.close("class")
+}
+
+func (w *xmlWriter) writeClassVarDec(dec *ast.ClassVarDec) {
+	w.open("classVarDec")
+	{
+		w.keyword(dec.Kind)
+		w.writeType(dec.Type)
+		w.writeVarNames(dec.Names)
+		w.symbol(";")
+	}
+	w.close("classVarDec")
+}
+
+func (w *xmlWriter) writeSubroutineDec(dec *ast.SubroutineDec) {
+	w.open("subroutineDec")
+	{
+		w.keyword(dec.Kind)
+		w.writeType(dec.ReturnType)
+		w.identifier(dec.Name.Name)
+		w.symbol("(")
+		w.writeParameterList(dec.Params)
+		w.symbol(")")
+		w.writeSubroutineBody(dec.Body)
+	}
+	w.close("subroutineDec")
+}
+
+func (w *xmlWriter) writeParameterList(params []*ast.Param) {
+	if len(params) == 0 {
+		w.empty("parameterList")
+		return
+	}
+	w.open("parameterList")
+	for i, param := range params {
+		if i > 0 {
+			w.symbol(",")
+		}
+		w.writeType(param.Type)
+		w.identifier(param.Name.Name)
+	}
+	w.close("parameterList")
+}
+
+func (w *xmlWriter) writeSubroutineBody(body *ast.SubroutineBody) {
+	w.open("subroutineBody")
+	{
+		w.symbol("{")
+		for _, dec := range body.Vars {
+			w.open("varDec")
+			{
+				w.keyword("var")
+				w.writeType(dec.Type)
+				w.writeVarNames(dec.Names)
+				w.symbol(";")
+			}
+			w.close("varDec")
+		}
+		w.writeStatements(body.Statements)
+		w.symbol("}")
+	}
+	w.close("subroutineBody")
+}
+
+func (w *xmlWriter) writeVarNames(names []*ast.Ident) {
+	for i, name := range names {
+		if i > 0 {
+			w.symbol(",")
+		}
+		w.identifier(name.Name)
+	}
+}
+
+func (w *xmlWriter) writeType(ttype *ast.Ident) {
+	if ttype.IsPrimitive() {
+		w.keyword(ttype.Name)
+	} else {
+		w.identifier(ttype.Name)
+	}
+}
+
+func (w *xmlWriter) writeStatements(stmts []ast.Stmt) {
+	if len(stmts) == 0 {
+		w.empty("statements")
+		return
+	}
+	w.open("statements")
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *ast.LetStmt:
+			w.open("letStatement")
+			{
+				w.keyword("let")
+				w.identifier(s.Name.Name)
+				if s.Index != nil {
+					w.symbol("[")
+					w.writeExpression(s.Index)
+					w.symbol("]")
+				}
+				w.symbol("=")
+				w.writeExpression(s.Value)
+				w.symbol(";")
+			}
+			w.close("letStatement")
+		case *ast.IfStmt:
+			w.open("ifStatement")
+			{
+				w.keyword("if")
+				w.symbol("(")
+				w.writeExpression(s.Cond)
+				w.symbol(")")
+				w.symbol("{")
+				w.writeStatements(s.Then)
+				w.symbol("}")
+				if s.HasElse {
+					w.keyword("else")
+					w.symbol("{")
+					w.writeStatements(s.Else)
+					w.symbol("}")
+				}
+			}
+			w.close("ifStatement")
+		case *ast.WhileStmt:
+			w.open("whileStatement")
+			{
+				w.keyword("while")
+				w.symbol("(")
+				w.writeExpression(s.Cond)
+				w.symbol(")")
+				w.symbol("{")
+				w.writeStatements(s.Body)
+				w.symbol("}")
+			}
+			w.close("whileStatement")
+		case *ast.DoStmt:
+			w.open("doStatement")
+			{
+				w.keyword("do")
+				w.writeSubroutineCall(s.Call)
+				w.symbol(";")
+			}
+			w.close("doStatement")
+		case *ast.ReturnStmt:
+			w.open("returnStatement")
+			{
+				w.keyword("return")
+				if s.Value != nil {
+					w.writeExpression(s.Value)
+				}
+				w.symbol(";")
+			}
+			w.close("returnStatement")
+		}
+	}
+	w.close("statements")
+}
+
+func (w *xmlWriter) writeExpression(expr ast.Expr) {
+	w.open("expression")
+	w.writeOperands(expr)
+	w.close("expression")
+}
+
+// writeOperands flattens a chain of binary expressions back to term (op term)*
+func (w *xmlWriter) writeOperands(expr ast.Expr) {
+	if bin, ok := expr.(*ast.BinaryExpr); ok {
+		w.writeOperands(bin.X)
+		w.symbol(bin.Op)
+		w.writeTerm(bin.Y)
+		return
+	}
+	w.writeTerm(expr)
+}
+
+func (w *xmlWriter) writeTerm(expr ast.Expr) {
+	w.open("term")
+	switch e := expr.(type) {
+	case *ast.IntLit:
+		w.element(IntConst, e.Value)
+	case *ast.StringLit:
+		w.element(StringConst, e.Value)
+	case *ast.KeywordLit:
+		w.keyword(e.Value)
+	case *ast.VarRef:
+		w.identifier(e.Name.Name)
+	case *ast.IndexExpr:
+		w.identifier(e.Name.Name)
+		w.symbol("[")
+		w.writeExpression(e.Index)
+		w.symbol("]")
+	case *ast.CallExpr:
+		w.writeSubroutineCall(e)
+	case *ast.ParenExpr:
+		w.symbol("(")
+		w.writeExpression(e.X)
+		w.symbol(")")
+	case *ast.UnaryExpr:
+		w.symbol(e.Op)
+		w.writeTerm(e.X)
+	}
+	w.close("term")
+}
+
+func (w *xmlWriter) writeSubroutineCall(call *ast.CallExpr) {
+	if call.Receiver != nil {
+		w.identifier(call.Receiver.Name)
+		w.symbol(".")
+	}
+	w.identifier(call.Name.Name)
+	w.symbol("(")
+	if len(call.Args) == 0 {
+		w.empty("expressionList")
+	} else {
+		w.open("expressionList")
+		for i, arg := range call.Args {
+			if i > 0 {
+				w.symbol(",")
+			}
+			w.writeExpression(arg)
+		}
+		w.close("expressionList")
+	}
+	w.symbol(")")
+}
+
+func (w *xmlWriter) keyword(value string) {
+	w.element(Keyword, value)
+}
+
+func (w *xmlWriter) symbol(value string) {
+	w.element(Symbol, value)
+}
+
+func (w *xmlWriter) identifier(value string) {
+	w.element(Identifier, value)
+}
+
+// element terminal element, e.g. <symbol> &lt; </symbol>
+func (w *xmlWriter) element(lex TokenType, value string) {
+	var sb strings.Builder
+	_ = xml.EscapeText(&sb, []byte(value))
+	w.line(w.depth, fmt.Sprintf("<%s> %s </%s>", lex, sb.String(), lex))
+}
+
+func (w *xmlWriter) open(tag string) {
+	w.line(w.depth, fmt.Sprintf("<%s>", tag))
+	w.depth++
+}
+
+func (w *xmlWriter) close(tag string) {
+	w.depth--
+	w.line(w.depth, fmt.Sprintf("</%s>", tag))
+}
+
+// empty non terminal without children, the reference analyzer prints the closing tag unindented
+func (w *xmlWriter) empty(tag string) {
+	w.line(w.depth, fmt.Sprintf("<%s>", tag))
+	w.line(0, fmt.Sprintf("</%s>", tag))
+}
+
+// line writes a new line, the last line of the document has no line break
+func (w *xmlWriter) line(depth int, text string) {
+	if w.lines > 0 {
+		_, _ = fmt.Fprint(w.dstFile, "\n")
+	}
+	_, _ = fmt.Fprintf(w.dstFile, "%s%s", strings.Repeat("  ", depth), text)
+	w.lines++
+}
@@ -0,0 +1,108 @@
+// This file is part of DD Jack Compiler.
+// Copyright (C) 2025-2025 Eduardo <dudssource@gmail.com>
+//
+// Jack Compiler is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Jack Compiler is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Jack Compiler.  If not, see <http://www.gnu.org/licenses/>.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/Dudssource/dd-jack-compiler/compiler"
+)
+
+// format formats the jack files, to stdout unless -w or -l are given
+func format(cmd *command, args []string) int {
+	var (
+		opts  options
+		flags = cmd.flagSet()
+		write bool
+		list  bool
+	)
+	flags.BoolVar(&write, "w", false, "write the result to the source files instead of stdout")
+	flags.BoolVar(&list, "l", false, "list the files whose formatting differs, instead of printing them")
+	opts.discoveryFlags(flags)
+
+	programs, code, ok := opts.parseArgs(flags, args, nil)
+	if !ok {
+		return code
+	}
+
+	var srcPaths []string
+	for _, prg := range programs {
+		srcPaths = append(srcPaths, prg.srcPaths...)
+	}
+
+	c := newCompilation(opts)
+	c.parallel(srcPaths, func(c *compilation, srcPath string) {
+		c.format(srcPath, write, list)
+	})
+
+	if c.failed > 0 {
+		c.logger.Printf("errors found in %d file(s)", c.failed)
+		return exitErrors
+	}
+	return exitOK
+}
+
+func (c *compilation) format(srcPath string, write, list bool) {
+	src, err := os.ReadFile(srcPath)
+	if err != nil {
+		c.fail(err)
+		return
+	}
+
+	var dst bytes.Buffer
+	diagnostics, err := compiler.Format(&dst, bytes.NewReader(src))
+	diagnostics.SetFile(srcPath)
+	if !c.report(diagnostics) {
+		return
+	}
+	if err != nil {
+		c.fail(err)
+		return
+	}
+
+	changed := !bytes.Equal(src, dst.Bytes())
+	if list && changed {
+		fmt.Fprintln(c.stdout, srcPath)
+	}
+	if write && changed {
+		info, err := os.Stat(srcPath)
+		if err != nil {
+			c.fail(err)
+			return
+		}
+		out, err := newOutput(srcPath, info.Mode().Perm())
+		if err != nil {
+			c.fail(err)
+			return
+		}
+		_, err = out.Write(dst.Bytes())
+		if err == nil {
+			err = out.commit()
+		} else {
+			out.discard()
+		}
+		if err != nil {
+			c.fail(err)
+		}
+	}
+	if !write && !list {
+		if _, err := c.stdout.Write(dst.Bytes()); err != nil {
+			c.fail(err)
+		}
+	}
+}
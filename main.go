@@ -17,104 +17,176 @@ package main
 
 import (
 	"errors"
+	"flag"
 	"fmt"
-	"log"
 	"os"
-	"path/filepath"
+	"runtime"
+	"slices"
 	"strings"
 
 	"github.com/Dudssource/dd-jack-compiler/compiler"
 )
 
-func main() {
+// exit codes
+const (
+	exitOK     = 0
+	exitErrors = 1 // the sources have errors (or warnings with -warnings error)
+	exitUsage  = 2
+)
 
-	// parse args
-	args := os.Args
+const usage = `Usage of JackCompiler:
+	JackCompiler [command] [flags] myProg/FileName.jack...
+	JackCompiler [command] [flags] myProg/...
 
-	// validate src
-	if len(args) != 2 {
-		log.Println(`Usage of jackcompiler:
-		JackCompiler myProg/FileName.jack
-		JackCompiler myProg/`)
-		os.Exit(0)
-	}
+Every folder is compiled as a single program, files given on their own are compiled along with the
+declarations of the other files of their folder. The files are built when no command is given.
 
-	var (
+Commands:
+`
 
-		// src path
-		srcPath = args[1]
-		// error list
-		errorList = make([]error, 0)
-	)
+// command subcommand of the compiler, sharing the discovery of the files and the diagnostics
+type command struct {
+	name    string
+	summary string
+	run     func(c *command, args []string) int
+}
 
-	// clean up src path
-	srcPath = strings.TrimRight(srcPath, string(os.PathSeparator))
+var commands = []*command{
+	{name: "build", summary: "compile the jack files to VM code (or to the -mode output)", run: build},
+	{name: "check", summary: "report the errors and warnings without writing any file", run: check},
+	{name: "tokens", summary: "write the tokenizer XML (FileNameT.xml)", run: tokens},
+	{name: "parse", summary: "write the parse tree (FileName.xml, or FileName.ast with -format ast)", run: parse},
+	{name: "fmt", summary: "format the jack files", run: format},
+	{name: "run", summary: "compile a program and run it, the OS is provided natively", run: runProgram},
+}
 
-	// stat
-	srcInfo, err := os.Stat(srcPath)
-	if err != nil {
-		log.Fatalf("stat %s : %s", srcPath, err.Error())
-	}
+// warnings levels
+const (
+	warningsNone    = "none"    // hide the warnings
+	warningsDefault = "default" // every warning but the optional ones
+	warningsAll     = "all"     // the optional warnings as well (shadowing)
+	warningsError   = "error"   // every warning, reported as errors
+)
 
-	// src is a directory, transverse to get all *.jack files
-	if srcInfo.IsDir() {
+// options command line flags
+type options struct {
+	outDir          string // next to the sources when empty, - for stdout
+	mode            compiler.OutputMode
+	warnings        string
+	typeCheck       compiler.TypeCheckLevel
+	typeCheckLevel  string // -typecheck, parsed into typeCheck
+	osDir           string
+	dropUnreachable bool
+	debug           bool
+	discard         bool // diagnostics only, no output is written
+	recursive       bool // every folder below the folders given is a program
+	jobs            int  // files and programs compiled at once
+}
 
-		// all matching vm files within directory
-		matches, err := filepath.Glob(fmt.Sprintf("%s/*.jack", strings.TrimRight(srcPath, string(os.PathSeparator))))
-		if err != nil {
-			log.Fatalf("glob %s", err.Error())
-		}
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
 
-		// translate all files
-		for _, srcPath := range matches {
-			// file name (without extension)
-			dstPath := strings.Split(filepath.Base(srcPath), ".")[0]
-			// analyse file
-			if err := analyse(srcPath, dstPath); err != nil {
-				errorList = append(errorList, fmt.Errorf("%s : %w", srcPath, err))
-			}
-		}
+func run(args []string) int {
+	if len(args) == 0 {
+		printUsage()
+		return exitUsage
+	}
 
-	} else {
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		printUsage()
+		return exitOK
+	}
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd.run(cmd, args[1:])
+		}
+	}
 
-		// file name (without extension)
-		dstPath := strings.Split(filepath.Base(srcPath), ".")[0]
+	// the files are built by default, as before the commands were introduced (e.g. the Makefile)
+	return build(commands[0], args)
+}
 
-		// analyse file
-		if err := analyse(srcPath, dstPath); err != nil {
-			errorList = append(errorList, fmt.Errorf("%s : %w", srcPath, err))
-		}
+func printUsage() {
+	fmt.Fprint(os.Stderr, usage)
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s%s\n", cmd.name, cmd.summary)
 	}
+	fmt.Fprintln(os.Stderr, "\nRun JackCompiler <command> -h for the flags of each command.")
+}
 
-	if len(errorList) > 0 {
-		log.Fatalf("errors found : %s", errors.Join(errorList...).Error())
+// flagSet flags of a command
+func (c *command) flagSet() *flag.FlagSet {
+	flags := flag.NewFlagSet("JackCompiler "+c.name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage of JackCompiler %s:\n\tJackCompiler %s [flags] myProg/FileName.jack...\n\tJackCompiler %s [flags] myProg/...\n\n",
+			c.name, c.name, c.name)
+		fmt.Fprintf(flags.Output(), "%s%s.\n\nFlags:\n", strings.ToUpper(c.summary[:1]), c.summary[1:])
+		flags.PrintDefaults()
 	}
+	return flags
 }
 
-func analyse(srcPath, dstPath string) error {
+// compilerFlags registers the flags of the commands compiling the sources
+func (opts *options) compilerFlags(flags *flag.FlagSet) {
+	flags.StringVar(&opts.warnings, "warnings", warningsDefault, "warnings: none, default, all (including shadowing) or error (warnings fail the build)")
+	flags.StringVar(&opts.typeCheckLevel, "typecheck", "off", "type checker strictness: off, loose or strict")
+	flags.StringVar(&opts.osDir, "os", "", "directory with jack files declaring the OS classes, overriding the bundled Jack OS API")
+}
 
-	// open src file
-	srcFile, err := os.Open(srcPath)
-	if err != nil {
-		return err
-	}
-	defer srcFile.Close()
+// discoveryFlags registers the flags of the commands accepting several programs
+func (opts *options) discoveryFlags(flags *flag.FlagSet) {
+	flags.BoolVar(&opts.recursive, "r", false, "compile every folder with jack files below the folders given, each one as a program")
+	flags.IntVar(&opts.jobs, "j", runtime.NumCPU(), "number of files (and programs) compiled at once")
+}
 
-	// create dst file
-	finalDstPath := filepath.Join(filepath.Dir(srcPath), dstPath+".vm")
-	dstFile, err := os.Create(finalDstPath)
-	if err != nil {
-		return err
+// parseArgs parses the flags of a command and groups the files given into programs, when the
+// command must stop the exit code is returned as well. validate checks the flags of the command
+func (opts *options) parseArgs(flags *flag.FlagSet, args []string, validate func() error) ([]*program, int, bool) {
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, exitOK, false
+		}
+		return nil, exitUsage, false
 	}
-	defer dstFile.Close()
 
-	// run the analyser
-	if err := compiler.NewJackAnalyser(srcFile, dstFile).Run(); err != nil {
-		return err
+	usageError := func(format string, args ...any) ([]*program, int, bool) {
+		fmt.Fprintf(flags.Output(), format+"\n", args...)
+		flags.Usage()
+		return nil, exitUsage, false
 	}
 
-	// ok
-	log.Printf("JACK Compiler finished successfully, output to %s\n", finalDstPath)
+	// validate flags
+	if validate != nil {
+		if err := validate(); err != nil {
+			return usageError("%s", err.Error())
+		}
+	}
+	if opts.warnings == "" {
+		opts.warnings = warningsDefault
+	}
+	if !slices.Contains([]string{warningsNone, warningsDefault, warningsAll, warningsError}, opts.warnings) {
+		return usageError("unknown warnings level %s", opts.warnings)
+	}
+	if opts.jobs < 0 {
+		return usageError("invalid -j %d", opts.jobs)
+	}
+	if opts.typeCheckLevel != "" {
+		typeCheck, err := compiler.ParseTypeCheckLevel(opts.typeCheckLevel)
+		if err != nil {
+			return usageError("%s", err.Error())
+		}
+		opts.typeCheck = typeCheck
+	}
+	if flags.NArg() == 0 {
+		return usageError("no jack file or folder given")
+	}
 
-	return nil
+	// group the files into programs
+	programs, err := discover(flags.Args(), opts.recursive)
+	if err != nil {
+		return usageError("%s", err.Error())
+	}
+	return programs, exitOK, true
 }
@@ -0,0 +1,105 @@
+// This file is part of DD Jack Compiler.
+// Copyright (C) 2025-2025 Eduardo <dudssource@gmail.com>
+//
+// Jack Compiler is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Jack Compiler is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Jack Compiler.  If not, see <http://www.gnu.org/licenses/>.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+
+	"github.com/Dudssource/dd-jack-compiler/compiler/vm"
+)
+
+// runProgram compiles a program in memory and runs it, the OS classes not found in the VM files of
+// its folder are provided by the machine
+func runProgram(cmd *command, args []string) int {
+	var (
+		opts  options
+		flags = cmd.flagSet()
+		steps int
+	)
+	opts.compilerFlags(flags)
+	flags.IntVar(&steps, "steps", 0, "stop the program after running this many VM instructions (0 runs it until it returns)")
+
+	programs, code, ok := opts.parseArgs(flags, args, func() error {
+		if steps < 0 {
+			return fmt.Errorf("invalid steps %d", steps)
+		}
+		return nil
+	})
+	if !ok {
+		return code
+	}
+	if len(programs) != 1 {
+		fmt.Fprintln(flags.Output(), "a single program can be run at once")
+		flags.Usage()
+		return exitUsage
+	}
+	// the whole folder is needed to run, even if a single file was given
+	prg := programs[0]
+	prg.srcPaths = append(prg.srcPaths, prg.declPaths...)
+	prg.declPaths = nil
+	slices.Sort(prg.srcPaths)
+
+	// compile
+	c := newCompilation(opts)
+	cprg, parsed, ok := c.load(prg)
+	if !ok {
+		return exitErrors
+	}
+	vmFiles, ok := c.compileAll(cprg, parsed)
+	if !ok {
+		log.Printf("errors found in %d file(s)", c.failed)
+		return exitErrors
+	}
+
+	// load, the other VM files of the folder after the compiled ones
+	machine := vm.New(os.Stdout, os.Stdin).WithMaxSteps(steps)
+	for _, srcPath := range parsed {
+		if err := machine.Load(baseName(srcPath), vmFiles[srcPath]); err != nil {
+			log.Println(err)
+			return exitErrors
+		}
+	}
+	vmPaths, err := prg.vmPaths()
+	if err != nil {
+		log.Println(err)
+		return exitErrors
+	}
+	for _, vmPath := range vmPaths {
+		src, err := os.ReadFile(vmPath)
+		if err == nil {
+			err = machine.Load(baseName(vmPath), bytes.NewReader(src))
+		}
+		if err != nil {
+			log.Println(err)
+			return exitErrors
+		}
+	}
+
+	if err := machine.Run(); err != nil {
+		if errors.Is(err, vm.ErrStepLimit) {
+			log.Printf("program stopped after %d steps", steps)
+		} else {
+			log.Printf("runtime error: %s", err)
+		}
+		return exitErrors
+	}
+	return exitOK
+}